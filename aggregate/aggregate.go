@@ -2,74 +2,278 @@ package aggregate
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/tags"
+
+	"github.com/shopspring/decimal"
 )
 
-func AggregateData(records []*domain.UsageRecord, config *domain.Config) (data map[string]*domain.Point) {
+// DefaultDimensions - Grouping dimensions used when the configuration does not declare any,
+// followed by one tag dimension per key in TagDefaults. PricingRule is added whenever pricing
+// rules are configured so every point records the rule that priced it
+var DefaultDimensions = []string{
+	"SubscriptionID",
+	"Subscription",
+	"MeterID",
+	"MeterCategory",
+	"MeterSubCategory",
+	"ResourceGroup",
+	"Resource",
+	"BillPeriod",
+}
+
+var dimensionValues = map[string]func(record *domain.UsageRecord, config *domain.Config) string{
+	"SubscriptionID": func(record *domain.UsageRecord, config *domain.Config) string {
+		return record.Properties.SubscriptionID
+	},
+	"Subscription":  func(record *domain.UsageRecord, config *domain.Config) string { return config.Subscription },
+	"MeterID":       func(record *domain.UsageRecord, config *domain.Config) string { return record.Properties.MeterID },
+	"MeterCategory": func(record *domain.UsageRecord, config *domain.Config) string { return record.Properties.MeterCategory },
+	"MeterSubCategory": func(record *domain.UsageRecord, config *domain.Config) string {
+		return record.Properties.MeterSubCategory
+	},
+	"MeterRegion":   func(record *domain.UsageRecord, config *domain.Config) string { return record.Properties.MeterRegion },
+	"Location":      location,
+	"ResourceGroup": func(record *domain.UsageRecord, config *domain.Config) string { return record.Properties.ResourceGroup },
+	"Resource":      func(record *domain.UsageRecord, config *domain.Config) string { return record.Properties.Resource },
+	"BillPeriod":    func(record *domain.UsageRecord, config *domain.Config) string { return record.Name },
+	"PricingRule":   func(record *domain.UsageRecord, config *domain.Config) string { return record.Properties.PricingRule },
+}
+
+// Dimensions - Returns the configured grouping dimensions, falling back to the defaults
+func Dimensions(config *domain.Config) (dimensions []string) {
+	if len(config.Dimensions) > 0 {
+		dimensions = append(dimensions, config.Dimensions...)
+	} else {
+		keys := make([]string, 0, len(config.TagDefaults))
+		for key := range config.TagDefaults {
+			keys = append(keys, fmt.Sprintf("_%s", key))
+		}
+		sort.Strings(keys)
+
+		dimensions = append(dimensions, DefaultDimensions...)
+		dimensions = append(dimensions, keys...)
+	}
+
+	if len(config.PricingRules) == 0 {
+		return dimensions
+	}
+
+	for _, dimension := range dimensions {
+		if dimension == "PricingRule" {
+			return dimensions
+		}
+	}
+
+	return append(dimensions, "PricingRule")
+}
+
+// ValidateDimensions - Ensures every dimension is known, tag dimensions start with an underscore
+func ValidateDimensions(dimensions []string) (err error) {
+	for _, dimension := range dimensions {
+		if strings.HasPrefix(dimension, "_") {
+			continue
+		}
+
+		if _, ok := dimensionValues[dimension]; !ok {
+			return fmt.Errorf("unknown aggregation dimension: %s", dimension)
+		}
+	}
+
+	return nil
+}
+
+func AggregateData(records []*domain.UsageRecord, config *domain.Config) (data map[string]*domain.Point, err error) {
 	data = make(map[string]*domain.Point)
+	dimensions := Dimensions(config)
+	granularity := Granularity(config)
+
+	loc, err := config.Location()
+	if err != nil {
+		return nil, err
+	}
 
 	for _, record := range records {
-		timestamp := record.Properties.UsageStartTime.Add(time.Duration(config.TimeOffset) + time.Hour)
-		key := fmt.Sprintf("%s/%s/%s/%s/%s/%s/%s/%s", record.Properties.SubscriptionID, record.Properties.MeterID, record.Properties.MeterCategory, record.Properties.MeterSubCategory, record.Properties.ResourceGroup, record.Properties.Resource, record.Name, timestamp.Format(time.RFC3339))
+		timestamp := Bucket(record.Properties.UsageStartTime, granularity, loc)
+		pointTags := CreateTags(record, config, dimensions)
+		sources := CreateTagSources(record, config, pointTags)
+
+		parts := make([]string, 0, len(dimensions)+1)
+		for _, dimension := range dimensions {
+			parts = append(parts, pointTags[dimension])
+		}
+		if config.TagPassthrough != nil {
+			parts = append(parts, TagKey(pointTags))
+		}
+		parts = append(parts, timestamp.Format(time.RFC3339))
+
+		key := strings.Join(parts, "/")
 		pd, found := data[key]
 		if !found {
-			tags := CreateTags(record, config)
-
 			pd = &domain.Point{
-				SubscriptionID:   record.Properties.SubscriptionID,
-				Subscription:     config.Subscription,
-				MeterID:          record.Properties.MeterID,
-				MeterCategory:    record.Properties.MeterCategory,
-				MeterSubCategory: record.Properties.MeterSubCategory,
-				ResourceGroup:    record.Properties.ResourceGroup,
-				Resource:         record.Properties.Resource,
-				BillPeriod:       record.Name,
-				Tags:             tags,
+				SubscriptionID:   pointTags["SubscriptionID"],
+				Subscription:     pointTags["Subscription"],
+				MeterID:          pointTags["MeterID"],
+				MeterCategory:    pointTags["MeterCategory"],
+				MeterSubCategory: pointTags["MeterSubCategory"],
+				MeterRegion:      pointTags["MeterRegion"],
+				Location:         pointTags["Location"],
+				ResourceGroup:    pointTags["ResourceGroup"],
+				Resource:         pointTags["Resource"],
+				BillPeriod:       pointTags["BillPeriod"],
+				PricingRule:      pointTags["PricingRule"],
+				Tags:             pointTags,
+				TagSources:       sources,
 				Quantity:         0,
-				Cost:             0,
+				Cost:             decimal.Zero,
+				AmortisedCost:    decimal.Zero,
+				Currency:         config.Currency,
 				Timestamp:        timestamp,
 			}
+
+			if _, ok := pointTags["MeterID"]; ok {
+				pd.Unit = record.Properties.Unit
+				pd.UnitPrice = record.Properties.MeterRate
+				pd.ListUnitPrice = record.Properties.ListRate
+			}
+
+			if _, ok := pointTags["Resource"]; ok && record.Properties.InstanceData != nil && len(record.Properties.InstanceData.Resources.ResourceURI) > 0 {
+				pd.ResourceID = fmt.Sprintf("/%s", record.Properties.InstanceData.Resources.ResourceURI)
+			}
+		} else {
+			tags.MergeSources(pd.TagSources, sources)
 		}
 
 		pd.Quantity += record.Properties.Quantity
-		pd.Cost += record.Properties.MeterRate * record.Properties.Quantity
+		pd.Cost = pd.Cost.Add(record.Properties.Cost)
+		pd.AmortisedCost = pd.AmortisedCost.Add(record.Properties.AmortisedCost)
 
 		data[key] = pd
 	}
 
-	return data
+	return data, nil
 }
 
-func CreateTags(record *domain.UsageRecord, config *domain.Config) (tags map[string]string) {
-	tags = map[string]string{
-		"SubscriptionID":   record.Properties.SubscriptionID,
-		"Subscription":     config.Subscription,
-		"MeterID":          record.Properties.MeterID,
-		"MeterCategory":    record.Properties.MeterCategory,
-		"MeterSubCategory": record.Properties.MeterSubCategory,
-		"BillPeriod":       record.Name,
-		"ResourceGroup":    record.Properties.ResourceGroup,
-		"Resource":         record.Properties.Resource,
+// Reconcile - Ensures the points sum to exactly the cost and amortised cost of the records they were
+// aggregated from
+func Reconcile(records []*domain.UsageRecord, points []*domain.Point) (err error) {
+	var cost, amortisedCost decimal.Decimal
+	for _, record := range records {
+		cost = cost.Add(record.Properties.Cost)
+		amortisedCost = amortisedCost.Add(record.Properties.AmortisedCost)
+	}
+
+	for _, point := range points {
+		cost = cost.Sub(point.Cost)
+		amortisedCost = amortisedCost.Sub(point.AmortisedCost)
 	}
 
-	for key, value := range config.TagDefaults {
-		tags[fmt.Sprintf("_%s", key)] = value
+	if !cost.IsZero() || !amortisedCost.IsZero() {
+		return fmt.Errorf("aggregated cost differs from record cost by %s, amortised cost by %s", cost, amortisedCost)
 	}
 
-	if record.Properties.InstanceData != nil {
-		for key, value := range record.Properties.InstanceData.Resources.Tags {
-			if _, ok := tags[fmt.Sprintf("_%s", key)]; !ok {
-				continue
+	return nil
+}
+
+// CreateTags - Builds the tags of a record for the given dimensions, tag dimensions fall back
+// to their TagDefaults value and then to MissingDefault. Resource tags selected by TagPassthrough
+// are added as further tag dimensions
+func CreateTags(record *domain.UsageRecord, config *domain.Config, dimensions []string) (pointTags map[string]string) {
+	pointTags = make(map[string]string)
+
+	for _, dimension := range dimensions {
+		if value, ok := dimensionValues[dimension]; ok {
+			pointTags[dimension] = value(record, config)
+			continue
+		}
+
+		key := strings.TrimPrefix(dimension, "_")
+
+		value, ok := config.TagDefaults[key]
+		if !ok {
+			value = config.MissingDefault
+		}
+
+		if record.Properties.InstanceData != nil {
+			if v := tags.String(record.Properties.InstanceData.Resources.Tags[key]); len(v) > 0 {
+				value = v
 			}
+		}
+
+		pointTags[dimension] = value
+	}
+
+	for dimension, value := range tags.Passthrough(record, config.TagPassthrough) {
+		if _, ok := pointTags[dimension]; !ok {
+			pointTags[dimension] = value
+		}
+	}
+
+	return pointTags
+}
+
+// CreateTagSources - Records the tier that supplied each tag dimension of the point tags of a record.
+// Resource tags without a recorded tier come from the resource, absent tags from the defaults
+func CreateTagSources(record *domain.UsageRecord, config *domain.Config, pointTags map[string]string) (sources map[string]string) {
+	sources = make(map[string]string)
+
+	for dimension := range pointTags {
+		if !strings.HasPrefix(dimension, "_") {
+			continue
+		}
+
+		key := strings.TrimPrefix(dimension, "_")
 
-			switch v := value.(type) {
-			case string:
-				tags[fmt.Sprintf("_%s", key)] = v
+		source := tags.SourceMissing
+		if _, ok := config.TagDefaults[key]; ok {
+			source = tags.SourceDefault
+		}
+
+		if record.Properties.InstanceData != nil && len(tags.String(record.Properties.InstanceData.Resources.Tags[key])) > 0 {
+			source = tags.SourceResource
+			if recorded, ok := record.Properties.TagSources[key]; ok {
+				source = recorded
 			}
 		}
+
+		sources[dimension] = source
+	}
+
+	return sources
+}
+
+func location(record *domain.UsageRecord, config *domain.Config) string {
+	if record.Properties.InstanceData == nil {
+		return ""
+	}
+
+	return record.Properties.InstanceData.Resources.Location
+}
+
+// SortedPoints - Returns the points ordered by timestamp and then by key
+func SortedPoints(data map[string]*domain.Point) (points []*domain.Point) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := data[keys[i]], data[keys[j]]
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	points = make([]*domain.Point, 0, len(keys))
+	for _, key := range keys {
+		points = append(points, data[key])
 	}
 
-	return tags
+	return points
 }
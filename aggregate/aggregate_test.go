@@ -0,0 +1,74 @@
+package aggregate
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
+)
+
+func usageRecord(group string, start time.Time, rate decimal.Decimal, quantity float64) *domain.UsageRecord {
+	record := &domain.UsageRecord{}
+	record.Properties.SubscriptionID = "sub"
+	record.Properties.ResourceGroup = group
+	record.Properties.MeterID = "meter"
+	record.Properties.UsageStartTime = start
+	record.Properties.Quantity = quantity
+	record.Properties.MeterRate = rate
+	record.Properties.Cost = rate.Mul(decimal.NewFromFloat(quantity))
+	record.Properties.AmortisedCost = record.Properties.Cost
+
+	return record
+}
+
+func TestAggregateDataSumsExactly(t *testing.T) {
+	config := &domain.Config{Dimensions: []string{"ResourceGroup", "MeterID"}}
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	rates := []decimal.Decimal{
+		decimal.RequireFromString("0.0000137"),
+		decimal.RequireFromString("0.1"),
+		decimal.RequireFromString("0.000333"),
+	}
+
+	var records []*domain.UsageRecord
+	floatTotal := 0.0
+	for i := 0; i < 30000; i++ {
+		record := usageRecord(fmt.Sprintf("rg-%d", i%7), start, rates[i%len(rates)], 0.3)
+		floatTotal += record.Properties.Cost.InexactFloat64()
+		records = append(records, record)
+	}
+
+	data, err := AggregateData(records, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points := SortedPoints(data)
+	if len(points) != 7 {
+		t.Fatalf("expected a point per resource group, got %d", len(points))
+	}
+
+	total := decimal.Zero
+	for _, point := range points {
+		total = total.Add(point.Cost)
+	}
+
+	// 10000 records at each rate for 0.3 units: (0.0000137 + 0.1 + 0.000333) * 0.3 * 10000
+	expected := decimal.RequireFromString("301.0401")
+	if !total.Equal(expected) {
+		t.Errorf("expected the points to sum to %s, got %s (float64 sums to %v)", expected, total, floatTotal)
+	}
+
+	if err := Reconcile(records, points); err != nil {
+		t.Error(err)
+	}
+
+	points[0].Cost = points[0].Cost.Add(decimal.New(1, -12))
+	if err := Reconcile(records, points); err == nil {
+		t.Error("expected a difference of 1e-12 to fail reconciliation")
+	}
+}
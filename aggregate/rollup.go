@@ -0,0 +1,192 @@
+package aggregate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/tags"
+
+	"github.com/shopspring/decimal"
+)
+
+// Granularities - Azure usage granularities and the bucket width each produces
+var Granularities = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"hourly": time.Hour,
+}
+
+// BucketEnd - End of the bucket starting at start, a daily bucket ends at the next local midnight
+// whatever the length of the day
+func BucketEnd(start time.Time, granularity string) time.Time {
+	if granularity == "daily" {
+		return start.AddDate(0, 0, 1)
+	}
+
+	return start.Add(Granularities[granularity])
+}
+
+// Periods - Rollup periods supported by Rollup
+var Periods = []string{"daily", "weekly", "monthly", "billperiod"}
+
+// BillPeriodDay - Returns the day of the month bill periods start on, falling back to the first
+func BillPeriodDay(config *domain.Config) int {
+	if config.BillPeriodDay <= 0 {
+		return 1
+	}
+
+	return config.BillPeriodDay
+}
+
+// Granularity - Returns the configured granularity, falling back to daily
+func Granularity(config *domain.Config) string {
+	if len(config.Granularity) == 0 {
+		return "daily"
+	}
+
+	return strings.ToLower(config.Granularity)
+}
+
+// ValidateRollups - Ensures the granularity and every rollup period are known
+func ValidateRollups(config *domain.Config) (err error) {
+	if _, ok := Granularities[Granularity(config)]; !ok {
+		return fmt.Errorf("unknown granularity: %s", config.Granularity)
+	}
+
+	for _, rollup := range config.Rollups {
+		found := false
+		for _, period := range Periods {
+			found = found || rollup == period
+		}
+
+		if !found {
+			return fmt.Errorf("unknown rollup period: %s", rollup)
+		}
+	}
+
+	if config.BillPeriodDay < 0 || config.BillPeriodDay > 28 {
+		return fmt.Errorf("bill period day must be between 1 and 28: %d", config.BillPeriodDay)
+	}
+
+	return nil
+}
+
+// Bucket - Returns the start of the granularity bucket of a usage timestamp in loc. Hourly usage is
+// converted to loc, daily usage is reported per UTC day so its UTC date is placed at midnight in loc
+func Bucket(timestamp time.Time, granularity string, loc *time.Location) time.Time {
+	if granularity == "hourly" {
+		return timestamp.In(loc).Truncate(time.Hour)
+	}
+
+	utc := timestamp.UTC()
+	return time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, loc)
+}
+
+// PeriodStart - Returns the start of the daily, weekly (Monday) or monthly period containing timestamp
+func PeriodStart(timestamp time.Time, period string) time.Time {
+	day := time.Date(timestamp.Year(), timestamp.Month(), timestamp.Day(), 0, 0, 0, 0, timestamp.Location())
+
+	switch period {
+	case "weekly":
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case "monthly":
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+
+	return day
+}
+
+// PeriodEnd - Returns the exclusive end of the period starting at start
+func PeriodEnd(start time.Time, period string) time.Time {
+	switch period {
+	case "weekly":
+		return start.AddDate(0, 0, 7)
+	case "monthly":
+		return start.AddDate(0, 1, 0)
+	}
+
+	return start.AddDate(0, 0, 1)
+}
+
+// RollupStart - Returns the start of the rollup period containing timestamp. Bill periods are
+// calendar months starting on the configured bill period day
+func RollupStart(timestamp time.Time, period string, config *domain.Config) time.Time {
+	if period != "billperiod" {
+		return PeriodStart(timestamp, period)
+	}
+
+	day := PeriodStart(timestamp, "daily")
+	start := time.Date(day.Year(), day.Month(), BillPeriodDay(config), 0, 0, 0, 0, day.Location())
+	if start.After(day) {
+		start = start.AddDate(0, -1, 0)
+	}
+
+	return start
+}
+
+// RollupEnd - Returns the exclusive end of the rollup period starting at start
+func RollupEnd(start time.Time, period string) time.Time {
+	if period == "billperiod" {
+		return start.AddDate(0, 1, 0)
+	}
+
+	return PeriodEnd(start, period)
+}
+
+// Rollup - Sums points into period buckets, keeping only periods fully inside [fromDate, toDate)
+// so that a partial period never overwrites a complete one
+func Rollup(points []*domain.Point, period string, config *domain.Config, fromDate, toDate time.Time) (data map[string]*domain.Point) {
+	data = make(map[string]*domain.Point)
+
+	for _, point := range points {
+		start := RollupStart(point.Timestamp, period, config)
+		if start.Before(fromDate) || RollupEnd(start, period).After(toDate) {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%s", TagKey(point.Tags), start.Format(time.RFC3339))
+		rp, found := data[key]
+		if !found {
+			copied := *point
+			copied.Quantity = 0
+			copied.Cost = decimal.Zero
+			copied.AmortisedCost = decimal.Zero
+			copied.Converted = make(map[string]decimal.Decimal)
+			copied.TagSources = tags.CopySources(point.TagSources)
+			copied.Timestamp = start
+			rp = &copied
+		} else {
+			tags.MergeSources(rp.TagSources, point.TagSources)
+		}
+
+		rp.Quantity += point.Quantity
+		rp.Cost = rp.Cost.Add(point.Cost)
+		rp.AmortisedCost = rp.AmortisedCost.Add(point.AmortisedCost)
+		for field, value := range point.Converted {
+			rp.Converted[field] = rp.Converted[field].Add(value)
+		}
+
+		data[key] = rp
+	}
+
+	return data
+}
+
+// TagKey - Builds a stable key from a tag set
+func TagKey(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", key, tags[key]))
+	}
+
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,18 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketDailyKeepsTheUTCDate(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	bucket := Bucket(time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), "daily", loc)
+	if expected := time.Date(2024, 3, 10, 0, 0, 0, 0, loc); !bucket.Equal(expected) {
+		t.Errorf("expected %s, got %s", expected, bucket)
+	}
+}
@@ -0,0 +1,233 @@
+package allocate
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/aggregate"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/tags"
+
+	"github.com/shopspring/decimal"
+)
+
+// UnallocatedValue - Tag value given to shared cost that no rule share could be found for
+const UnallocatedValue = "Unallocated"
+
+// Validate - Ensures every rule has a known method, usable shares and a tag that is an aggregation dimension
+func Validate(rules []*domain.AllocationRule, dimensions []string) (err error) {
+	for _, rule := range rules {
+		found := false
+		for _, dimension := range dimensions {
+			found = found || dimension == fmt.Sprintf("_%s", rule.TagKey)
+		}
+
+		if !found {
+			return fmt.Errorf("allocation rule %s: tag %s is not an aggregation dimension", rule.Name, rule.TagKey)
+		}
+
+		if _, err := path.Match(rule.ResourceGroup, ""); err != nil {
+			return fmt.Errorf("allocation rule %s: %v", rule.Name, err)
+		}
+
+		switch rule.Method {
+		case "fixed":
+			if total(rule.Shares) <= 0 {
+				return fmt.Errorf("allocation rule %s: fixed shares must be positive", rule.Name)
+			}
+		case "proportional":
+		default:
+			return fmt.Errorf("allocation rule %s: unknown method %s", rule.Name, rule.Method)
+		}
+	}
+
+	return nil
+}
+
+// Allocate - Returns the points with the cost of shared resource groups split across tag values.
+// Points outside any rule pass through unchanged so the allocated series reconciles with the original
+func Allocate(points []*domain.Point, rules []*domain.AllocationRule) (allocated []*domain.Point) {
+	data := make(map[string]*domain.Point)
+	spend := consumerSpend(points, rules)
+
+	for _, point := range points {
+		rule := match(point, rules)
+		if rule == nil {
+			add(data, point)
+			continue
+		}
+
+		shares := rule.Shares
+		if rule.Method == "proportional" {
+			if consumers := spend[spendKey(rule, point)]; total(consumers) > 0 {
+				shares = consumers
+			}
+		}
+
+		if total(shares) <= 0 {
+			shares = map[string]float64{UnallocatedValue: 1}
+		}
+
+		for _, share := range split(point, rule, shares) {
+			add(data, share)
+		}
+	}
+
+	return aggregate.SortedPoints(data)
+}
+
+// Reconcile - Ensures the allocated points sum to exactly the same cost as the original points per timestamp
+func Reconcile(points, allocated []*domain.Point) (err error) {
+	totals := make(map[time.Time]decimal.Decimal)
+	for _, point := range points {
+		totals[point.Timestamp] = totals[point.Timestamp].Add(point.Cost)
+	}
+
+	for _, point := range allocated {
+		totals[point.Timestamp] = totals[point.Timestamp].Sub(point.Cost)
+	}
+
+	for timestamp, diff := range totals {
+		if !diff.IsZero() {
+			return fmt.Errorf("allocated cost for %s differs from unallocated cost by %s", timestamp.Format(time.RFC3339), diff)
+		}
+	}
+
+	return nil
+}
+
+func match(point *domain.Point, rules []*domain.AllocationRule) *domain.AllocationRule {
+	for _, rule := range rules {
+		if ok, _ := path.Match(strings.ToLower(rule.ResourceGroup), strings.ToLower(point.ResourceGroup)); ok {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+func spendKey(rule *domain.AllocationRule, point *domain.Point) string {
+	return fmt.Sprintf("%s/%s/%s", rule.Name, point.SubscriptionID, point.Timestamp.Format(time.RFC3339))
+}
+
+// consumerSpend - Sums the cost per tag value of the points outside shared resource groups
+func consumerSpend(points []*domain.Point, rules []*domain.AllocationRule) (spend map[string]map[string]float64) {
+	spend = make(map[string]map[string]float64)
+
+	for _, point := range points {
+		if match(point, rules) != nil {
+			continue
+		}
+
+		for _, rule := range rules {
+			if rule.Method != "proportional" {
+				continue
+			}
+
+			value := point.Tags[fmt.Sprintf("_%s", rule.TagKey)]
+			if len(value) == 0 || !point.Cost.IsPositive() {
+				continue
+			}
+
+			key := spendKey(rule, point)
+			if spend[key] == nil {
+				spend[key] = make(map[string]float64)
+			}
+			spend[key][value] += point.Cost.InexactFloat64()
+		}
+	}
+
+	return spend
+}
+
+// split - Divides a point across the share values, the last share takes the rounding remainder
+func split(point *domain.Point, rule *domain.AllocationRule, shares map[string]float64) (points []*domain.Point) {
+	values := make([]string, 0, len(shares))
+	for value, share := range shares {
+		if share > 0 {
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+
+	sum := total(shares)
+	cost, amortisedCost, quantity := point.Cost, point.AmortisedCost, point.Quantity
+	converted := make(map[string]decimal.Decimal)
+	for field, value := range point.Converted {
+		converted[field] = value
+	}
+
+	for i, value := range values {
+		share := *point
+		share.Tags = make(map[string]string)
+		for k, v := range point.Tags {
+			share.Tags[k] = v
+		}
+		share.Tags[fmt.Sprintf("_%s", rule.TagKey)] = value
+		share.Tags["AllocationRule"] = rule.Name
+		share.TagSources = tags.CopySources(point.TagSources)
+		share.TagSources[fmt.Sprintf("_%s", rule.TagKey)] = tags.SourceAllocation
+		share.Converted = make(map[string]decimal.Decimal)
+
+		if i == len(values)-1 {
+			share.Cost, share.AmortisedCost, share.Quantity = cost, amortisedCost, quantity
+			for field, fieldCost := range converted {
+				share.Converted[field] = fieldCost
+			}
+		} else {
+			ratio := decimal.NewFromFloat(shares[value]).Div(decimal.NewFromFloat(sum))
+			share.Cost = point.Cost.Mul(ratio)
+			share.AmortisedCost = point.AmortisedCost.Mul(ratio)
+			share.Quantity = point.Quantity * shares[value] / sum
+			cost = cost.Sub(share.Cost)
+			amortisedCost = amortisedCost.Sub(share.AmortisedCost)
+			quantity -= share.Quantity
+			for field, fieldCost := range point.Converted {
+				share.Converted[field] = fieldCost.Mul(ratio)
+				converted[field] = converted[field].Sub(share.Converted[field])
+			}
+		}
+
+		points = append(points, &share)
+	}
+
+	return points
+}
+
+func add(data map[string]*domain.Point, point *domain.Point) {
+	key := fmt.Sprintf("%s/%s", aggregate.TagKey(point.Tags), point.Timestamp.Format(time.RFC3339))
+
+	existing, found := data[key]
+	if !found {
+		copied := *point
+		copied.Converted = make(map[string]decimal.Decimal)
+		for field, value := range point.Converted {
+			copied.Converted[field] = value
+		}
+		copied.TagSources = tags.CopySources(point.TagSources)
+		data[key] = &copied
+		return
+	}
+
+	tags.MergeSources(existing.TagSources, point.TagSources)
+
+	existing.Cost = existing.Cost.Add(point.Cost)
+	existing.AmortisedCost = existing.AmortisedCost.Add(point.AmortisedCost)
+	for field, value := range point.Converted {
+		existing.Converted[field] = existing.Converted[field].Add(value)
+	}
+	existing.Quantity += point.Quantity
+}
+
+func total(shares map[string]float64) (sum float64) {
+	for _, share := range shares {
+		if share > 0 {
+			sum += share
+		}
+	}
+
+	return sum
+}
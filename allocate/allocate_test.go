@@ -0,0 +1,90 @@
+package allocate
+
+import (
+	"testing"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
+)
+
+func point(group, team, cost string, timestamp time.Time) *domain.Point {
+	return &domain.Point{
+		SubscriptionID: "sub",
+		ResourceGroup:  group,
+		Cost:           decimal.RequireFromString(cost),
+		AmortisedCost:  decimal.RequireFromString(cost),
+		Tags:           map[string]string{"ResourceGroup": group, "_Team": team},
+		Timestamp:      timestamp,
+	}
+}
+
+func TestProportionalSplitOfOneCent(t *testing.T) {
+	timestamp := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	points := []*domain.Point{
+		point("shared", "", "0.01", timestamp),
+		point("rg-a", "a", "5", timestamp),
+		point("rg-b", "b", "5", timestamp),
+		point("rg-c", "c", "5", timestamp),
+	}
+	rules := []*domain.AllocationRule{{Name: "shared", ResourceGroup: "shared", TagKey: "Team", Method: "proportional"}}
+
+	allocated := Allocate(points, rules)
+	if err := Reconcile(points, allocated); err != nil {
+		t.Fatal(err)
+	}
+
+	shares := decimal.Zero
+	count := 0
+	for _, p := range allocated {
+		if p.ResourceGroup != "shared" {
+			continue
+		}
+
+		count++
+		shares = shares.Add(p.Cost)
+		if p.Cost.LessThan(decimal.RequireFromString("0.0033")) || p.Cost.GreaterThan(decimal.RequireFromString("0.0034")) {
+			t.Errorf("expected a third of a cent for %s, got %s", p.Tags["_Team"], p.Cost)
+		}
+	}
+
+	if count != 3 {
+		t.Fatalf("expected 3 shares, got %d", count)
+	}
+
+	if !shares.Equal(decimal.RequireFromString("0.01")) {
+		t.Errorf("expected the shares to sum to exactly 0.01, got %s", shares)
+	}
+}
+
+func TestFixedSplitReconciles(t *testing.T) {
+	timestamp := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	points := []*domain.Point{point("shared", "", "100.07", timestamp)}
+	rules := []*domain.AllocationRule{{
+		Name:          "shared",
+		ResourceGroup: "shared",
+		TagKey:        "Team",
+		Method:        "fixed",
+		Shares:        map[string]float64{"a": 1, "b": 1, "c": 1},
+	}}
+
+	allocated := Allocate(points, rules)
+	if len(allocated) != 3 {
+		t.Fatalf("expected 3 shares, got %d", len(allocated))
+	}
+
+	if err := Reconcile(points, allocated); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReconcileDetectsDifferences(t *testing.T) {
+	timestamp := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	points := []*domain.Point{point("rg", "a", "1.00", timestamp)}
+	allocated := []*domain.Point{point("rg", "a", "0.99", timestamp)}
+
+	if err := Reconcile(points, allocated); err == nil {
+		t.Error("expected a difference of 0.01 to fail reconciliation")
+	}
+}
@@ -0,0 +1,199 @@
+package amortise
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
+)
+
+// ReservationCategory - Meter category of the synthetic records for purchases and unused hours
+const ReservationCategory = "Reservation"
+
+// PurchaseSubCategory - Meter subcategory of the synthetic purchase records
+const PurchaseSubCategory = "Purchase"
+
+// Amortiser - Spreads reservation purchases over their term and prices covered usage from them
+type Amortiser struct {
+	config       *domain.Config
+	transactions []*domain.ReservationTransaction
+}
+
+func NewAmortiser(config *domain.Config, transactions []*domain.ReservationTransaction) *Amortiser {
+	var purchases []*domain.ReservationTransaction
+	for _, t := range transactions {
+		if strings.EqualFold(t.EventType, "Purchase") {
+			purchases = append(purchases, t)
+		}
+	}
+
+	return &Amortiser{
+		config:       config,
+		transactions: purchases,
+	}
+}
+
+// period - Days a purchase is amortised over: a monthly instalment covers one month, an upfront
+// purchase covers the reservation term
+func period(t *domain.ReservationTransaction) (start, end time.Time) {
+	start = time.Date(t.EventDate.Year(), t.EventDate.Month(), t.EventDate.Day(), 0, 0, 0, 0, time.UTC)
+
+	if strings.EqualFold(t.BillingFrequency, "Monthly") || strings.EqualFold(t.BillingFrequency, "Recurring") {
+		return start, start.AddDate(0, 1, 0)
+	}
+
+	switch strings.ToUpper(t.Term) {
+	case "P3Y":
+		return start, start.AddDate(3, 0, 0)
+	case "P5Y":
+		return start, start.AddDate(5, 0, 0)
+	}
+
+	return start, start.AddDate(1, 0, 0)
+}
+
+// dailyCost - Amortised cost per reservation order for a UTC date
+func (a *Amortiser) dailyCost(date time.Time) (orders map[string]decimal.Decimal) {
+	orders = make(map[string]decimal.Decimal)
+
+	for _, t := range a.transactions {
+		start, end := period(t)
+		if date.Before(start) || !date.Before(end) {
+			continue
+		}
+
+		order := strings.ToLower(t.ReservationOrderID)
+		days := decimal.NewFromFloat(end.Sub(start).Hours() / 24)
+		orders[order] = orders[order].Add(decimal.NewFromFloat(t.Amount).Div(days))
+	}
+
+	return orders
+}
+
+// Apply - Moves the reservation-covered part of each hourly record of day from on-demand cost to an
+// amortised share of its reservation. Returns synthetic records carrying purchases as actual cost and
+// unused reservation hours as amortised cost so both views reconcile with the invoice
+func (a *Amortiser) Apply(records []*domain.UsageRecord, day time.Time, details []*domain.ReservationDetail) (extra []*domain.UsageRecord) {
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	dateText := date.Format("2006-01-02")
+	orders := a.dailyCost(date)
+
+	reserved := make(map[string]float64)
+	used := make(map[string]float64)
+	reservations := make(map[string]bool)
+	instanceOrders := make(map[string]string)
+	instanceHours := make(map[string]float64)
+
+	for _, d := range details {
+		if d.UsageDate.UTC().Format("2006-01-02") != dateText {
+			continue
+		}
+
+		// Reserved hours cover the whole reservation and repeat on the row of every instance it covers
+		order := strings.ToLower(d.ReservationOrderID)
+		reservation := fmt.Sprintf("%s/%s", order, strings.ToLower(d.ReservationID))
+		if !reservations[reservation] {
+			reservations[reservation] = true
+			reserved[order] += d.ReservedHours
+		}
+		used[order] += d.UsedHours
+
+		if len(d.InstanceID) > 0 {
+			instance := strings.ToLower(strings.Trim(d.InstanceID, "/"))
+			instanceOrders[instance] = order
+			instanceHours[instance] += d.UsedHours
+		}
+	}
+
+	for _, record := range records {
+		if record.Properties.InstanceData == nil || !strings.Contains(strings.ToLower(record.Properties.Unit), "hour") {
+			continue
+		}
+
+		instance := strings.ToLower(strings.Trim(record.Properties.InstanceData.Resources.ResourceURI, "/"))
+		order, found := instanceOrders[instance]
+		if !found || instanceHours[instance] <= 0 || reserved[order] <= 0 {
+			continue
+		}
+
+		covered := record.Properties.Quantity
+		if covered > instanceHours[instance] {
+			covered = instanceHours[instance]
+		}
+		instanceHours[instance] -= covered
+
+		share := orders[order].Mul(decimal.NewFromFloat(covered)).Div(decimal.NewFromFloat(reserved[order]))
+		record.Properties.Cost = record.Properties.Cost.Sub(record.Properties.MeterRate.Mul(decimal.NewFromFloat(covered)))
+		record.Properties.AmortisedCost = record.Properties.Cost.Add(share)
+	}
+
+	for order, cost := range orders {
+		if !a.owned(order) {
+			continue
+		}
+
+		unused, unusedCost := 0.0, cost
+		if reserved[order] > 0 {
+			unused = reserved[order] - used[order]
+			unusedCost = cost.Mul(decimal.NewFromFloat(unused)).Div(decimal.NewFromFloat(reserved[order]))
+		}
+
+		if unusedCost.IsPositive() {
+			extra = append(extra, a.record(order, "Unused", day, decimal.Zero, unusedCost, unused))
+		}
+	}
+
+	for _, t := range a.transactions {
+		order := strings.ToLower(t.ReservationOrderID)
+		if t.EventDate.UTC().Format("2006-01-02") == dateText && a.owned(order) {
+			extra = append(extra, a.record(order, PurchaseSubCategory, day, decimal.NewFromFloat(t.Amount), decimal.Zero, t.Quantity))
+		}
+	}
+
+	return extra
+}
+
+// owned - Purchases and unused hours are reported by the subscription that bought the reservation
+func (a *Amortiser) owned(order string) bool {
+	for _, t := range a.transactions {
+		if strings.EqualFold(t.ReservationOrderID, order) {
+			return len(t.PurchasingSubscriptionGUID) == 0 || strings.EqualFold(t.PurchasingSubscriptionGUID, a.config.SubscriptionID)
+		}
+	}
+
+	return false
+}
+
+func (a *Amortiser) record(order, kind string, day time.Time, cost, amortisedCost decimal.Decimal, quantity float64) *domain.UsageRecord {
+	record := &domain.UsageRecord{
+		ID:   fmt.Sprintf("reservation/%s/%s/%s", order, kind, day.Format("2006-01-02")),
+		Type: ReservationCategory,
+	}
+
+	// Stamped at UTC midnight of the local date like the daily usage records Azure reports
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+
+	record.Properties.SubscriptionID = a.config.SubscriptionID
+	record.Properties.UsageStartTime = start
+	record.Properties.UsageEndTime = start.AddDate(0, 0, 1)
+	record.Properties.MeterID = order
+	record.Properties.MeterName = kind
+	record.Properties.MeterCategory = ReservationCategory
+	record.Properties.MeterSubCategory = kind
+	record.Properties.Resource = order
+	record.Properties.Unit = "Hours"
+	record.Properties.Quantity = quantity
+	record.Properties.Cost = cost
+	record.Properties.AmortisedCost = amortisedCost
+
+	for _, t := range a.transactions {
+		if strings.EqualFold(t.ReservationOrderID, order) && len(t.ReservationOrderName) > 0 {
+			record.Properties.Resource = t.ReservationOrderName
+		}
+	}
+
+	return record
+}
@@ -0,0 +1,57 @@
+package amortise
+
+import (
+	"testing"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
+)
+
+func hourlyRecord(instance string, hours float64) *domain.UsageRecord {
+	record := &domain.UsageRecord{}
+	record.Properties.Unit = "1 Hour"
+	record.Properties.Quantity = hours
+	record.Properties.MeterRate = decimal.NewFromInt(1)
+	record.Properties.Cost = decimal.NewFromFloat(hours)
+	record.Properties.AmortisedCost = record.Properties.Cost
+	record.Properties.InstanceData = &domain.InstanceData{}
+	record.Properties.InstanceData.Resources.ResourceURI = instance
+
+	return record
+}
+
+func TestApplyCountsReservedHoursOncePerReservation(t *testing.T) {
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	config := &domain.Config{SubscriptionID: "sub"}
+	a := NewAmortiser(config, []*domain.ReservationTransaction{{
+		ReservationOrderID: "order",
+		EventType:          "Purchase",
+		EventDate:          day,
+		BillingFrequency:   "Monthly",
+		Amount:             31 * 48,
+		Quantity:           2,
+	}})
+
+	// A quantity-2 reservation fully used by two instances reports its 48 reserved hours on both rows
+	details := []*domain.ReservationDetail{
+		{ReservationOrderID: "order", ReservationID: "res", ReservedHours: 48, UsedHours: 24, UsageDate: day, InstanceID: "/vm1"},
+		{ReservationOrderID: "order", ReservationID: "res", ReservedHours: 48, UsedHours: 24, UsageDate: day, InstanceID: "/vm2"},
+	}
+	records := []*domain.UsageRecord{hourlyRecord("vm1", 24), hourlyRecord("vm2", 24)}
+
+	extra := a.Apply(records, day, details)
+
+	for _, record := range records {
+		if !record.Properties.Cost.IsZero() || !record.Properties.AmortisedCost.Equal(decimal.NewFromInt(24)) {
+			t.Errorf("expected covered usage to cost 0 and amortise to 24, got %s and %s", record.Properties.Cost, record.Properties.AmortisedCost)
+		}
+	}
+
+	for _, record := range extra {
+		if record.Properties.MeterSubCategory == "Unused" {
+			t.Errorf("expected no unused hours for a fully used reservation, got %v", record.Properties.Quantity)
+		}
+	}
+}
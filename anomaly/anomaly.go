@@ -0,0 +1,197 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/aggregate"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+// DefaultDimensions - Baseline key used when the configuration does not specify one
+var DefaultDimensions = []string{"ResourceGroup", "Resource", "MeterID"}
+
+const (
+	defaultWindow     = 28
+	defaultMinHistory = 7
+	defaultZScore     = 3
+)
+
+type day struct {
+	timestamp time.Time
+	cost      float64
+}
+
+// Detect - Sums the points per baseline key and day, compares every day with the mean of the days
+// before it in history and records the day in history. Only increases are flagged, so the partial
+// current day does not raise alerts
+func Detect(points []*domain.Point, config *domain.AnomalyConfig, history map[string][]*domain.DailyCost) (anomalies []*domain.Anomaly) {
+	dimensions := config.Dimensions
+	if len(dimensions) == 0 {
+		dimensions = DefaultDimensions
+	}
+
+	window := config.Window
+	if window <= 0 {
+		window = defaultWindow
+	}
+
+	minHistory := config.MinHistory
+	if minHistory <= 0 {
+		minHistory = defaultMinHistory
+	}
+
+	zScore := config.ZScore
+	if zScore <= 0 && config.Percent <= 0 {
+		zScore = defaultZScore
+	}
+
+	days := make(map[string]map[string]*day)
+	keyTags := make(map[string]map[string]string)
+
+	for _, point := range points {
+		tags := make(map[string]string)
+		parts := make([]string, 0, len(dimensions))
+		for _, dimension := range dimensions {
+			tags[dimension] = point.Tags[dimension]
+			parts = append(parts, point.Tags[dimension])
+		}
+		key := strings.Join(parts, "/")
+		keyTags[key] = tags
+
+		if days[key] == nil {
+			days[key] = make(map[string]*day)
+		}
+
+		timestamp := aggregate.PeriodStart(point.Timestamp, "daily")
+		date := timestamp.Format("2006-01-02")
+		d, found := days[key][date]
+		if !found {
+			d = &day{timestamp: timestamp}
+			days[key][date] = d
+		}
+		d.cost += point.Cost.InexactFloat64()
+	}
+
+	keys := make([]string, 0, len(days))
+	for key := range days {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		dates := make([]string, 0, len(days[key]))
+		for date := range days[key] {
+			dates = append(dates, date)
+		}
+		sort.Strings(dates)
+
+		for _, date := range dates {
+			d := days[key][date]
+
+			var baseline []float64
+			for _, entry := range history[key] {
+				if entry.Date < date {
+					baseline = append(baseline, entry.Cost)
+				}
+			}
+			if len(baseline) > window {
+				baseline = baseline[len(baseline)-window:]
+			}
+
+			if len(baseline) >= minHistory && d.cost >= config.MinCost {
+				mean, stdDev := stats(baseline)
+
+				a := &domain.Anomaly{
+					Key:       key,
+					Tags:      keyTags[key],
+					Timestamp: d.timestamp,
+					Cost:      d.cost,
+					Mean:      mean,
+					StdDev:    stdDev,
+				}
+				if stdDev > 0 {
+					a.ZScore = (d.cost - mean) / stdDev
+				}
+				if mean > 0 {
+					a.Deviation = (d.cost - mean) / mean * 100
+				}
+
+				if (zScore > 0 && stdDev > 0 && a.ZScore >= zScore) || (config.Percent > 0 && mean > 0 && a.Deviation >= config.Percent) {
+					anomalies = append(anomalies, a)
+				}
+			}
+
+			history[key] = record(history[key], date, d.cost, window*2)
+		}
+	}
+
+	return anomalies
+}
+
+// Alert - Describes an anomaly as a notification
+func Alert(a *domain.Anomaly) *domain.Alert {
+	date := a.Timestamp.Format("2006-01-02")
+
+	details := map[string]interface{}{
+		"date":      date,
+		"cost":      a.Cost,
+		"mean":      a.Mean,
+		"stdDev":    a.StdDev,
+		"zScore":    a.ZScore,
+		"deviation": a.Deviation,
+	}
+	for key, value := range a.Tags {
+		details[key] = value
+	}
+
+	return &domain.Alert{
+		ID:        fmt.Sprintf("anomaly/%s/%s", a.Key, date),
+		Kind:      "anomaly",
+		Subject:   fmt.Sprintf("Cost anomaly for %s on %s", a.Key, date),
+		Message:   fmt.Sprintf("Cost of %.2f on %s is %+.1f%% against a baseline of %.2f (z-score %.1f)", a.Cost, date, a.Deviation, a.Mean, a.ZScore),
+		Timestamp: a.Timestamp,
+		Details:   details,
+	}
+}
+
+func stats(values []float64) (mean, stdDev float64) {
+	for _, value := range values {
+		mean += value
+	}
+	mean /= float64(len(values))
+
+	for _, value := range values {
+		stdDev += (value - mean) * (value - mean)
+	}
+	stdDev = math.Sqrt(stdDev / float64(len(values)))
+
+	return mean, stdDev
+}
+
+// record - Inserts or replaces the cost of a date, keeping the history sorted and at most limit long
+func record(entries []*domain.DailyCost, date string, cost float64, limit int) []*domain.DailyCost {
+	replaced := false
+	for _, entry := range entries {
+		if entry.Date == date {
+			entry.Cost = cost
+			replaced = true
+		}
+	}
+
+	if !replaced {
+		entries = append(entries, &domain.DailyCost{Date: date, Cost: cost})
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Date < entries[j].Date
+		})
+	}
+
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	return entries
+}
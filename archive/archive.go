@@ -0,0 +1,190 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/output"
+)
+
+// ReadingsPath - Path of the archived usage records of a subscription for a day
+func ReadingsPath(dir, subscription string, day time.Time) string {
+	return filepath.Join(dir, subscription, fmt.Sprintf("%s.ndjson.gz", day.Format("2006-01-02")))
+}
+
+// MetersPath - Path of the most recently archived rate card of a subscription
+func MetersPath(dir, subscription string) string {
+	return filepath.Join(dir, subscription, "meters.json.gz")
+}
+
+// GroupsPath - Path of the most recently archived resource groups of a subscription
+func GroupsPath(dir, subscription string) string {
+	return filepath.Join(dir, subscription, "groups.json.gz")
+}
+
+// SubscriptionTagsPath - Path of the most recently archived tags of a subscription
+func SubscriptionTagsPath(dir, subscription string) string {
+	return filepath.Join(dir, subscription, "subscription-tags.json.gz")
+}
+
+// ReservationDetailsPath - Path of the archived reservation usage of a subscription for a day
+func ReservationDetailsPath(dir, subscription string, day time.Time) string {
+	return filepath.Join(dir, subscription, fmt.Sprintf("%s.reservations.json.gz", day.Format("2006-01-02")))
+}
+
+// ReservationTransactionsPath - Path of the most recently archived reservation transactions
+func ReservationTransactionsPath(dir, subscription string) string {
+	return filepath.Join(dir, subscription, "reservation-transactions.json.gz")
+}
+
+// WriteReadings - Archives the usage records of a day as compressed NDJSON
+func WriteReadings(dir, subscription string, day time.Time, records []*domain.UsageRecord) (err error) {
+	return write(ReadingsPath(dir, subscription, day), func(enc *json.Encoder) error {
+		for _, record := range records {
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ReadReadings - Loads the archived usage records of a day
+func ReadReadings(dir, subscription string, day time.Time) (records []*domain.UsageRecord, err error) {
+	err = read(ReadingsPath(dir, subscription, day), func(dec *json.Decoder) error {
+		for dec.More() {
+			var record *domain.UsageRecord
+			if err := dec.Decode(&record); err != nil {
+				return err
+			}
+
+			records = append(records, record)
+		}
+
+		return nil
+	})
+
+	return records, err
+}
+
+// WriteMeters - Archives the rate card used for pricing
+func WriteMeters(dir, subscription string, meters map[string]*domain.Meter) (err error) {
+	return write(MetersPath(dir, subscription), func(enc *json.Encoder) error {
+		return enc.Encode(meters)
+	})
+}
+
+// ReadMeters - Loads the archived rate card
+func ReadMeters(dir, subscription string) (meters map[string]*domain.Meter, err error) {
+	err = read(MetersPath(dir, subscription), func(dec *json.Decoder) error {
+		return dec.Decode(&meters)
+	})
+
+	return meters, err
+}
+
+// WriteGroups - Archives the resource groups used for tag defaults
+func WriteGroups(dir, subscription string, groups map[string]*domain.Group) (err error) {
+	return write(GroupsPath(dir, subscription), func(enc *json.Encoder) error {
+		return enc.Encode(groups)
+	})
+}
+
+// ReadGroups - Loads the archived resource groups
+func ReadGroups(dir, subscription string) (groups map[string]*domain.Group, err error) {
+	err = read(GroupsPath(dir, subscription), func(dec *json.Decoder) error {
+		return dec.Decode(&groups)
+	})
+
+	return groups, err
+}
+
+// WriteSubscriptionTags - Archives the subscription tags used for tag defaults
+func WriteSubscriptionTags(dir, subscription string, tags map[string]interface{}) (err error) {
+	return write(SubscriptionTagsPath(dir, subscription), func(enc *json.Encoder) error {
+		return enc.Encode(tags)
+	})
+}
+
+// ReadSubscriptionTags - Loads the archived subscription tags
+func ReadSubscriptionTags(dir, subscription string) (tags map[string]interface{}, err error) {
+	err = read(SubscriptionTagsPath(dir, subscription), func(dec *json.Decoder) error {
+		return dec.Decode(&tags)
+	})
+
+	return tags, err
+}
+
+// WriteReservationDetails - Archives the reservation usage of a day
+func WriteReservationDetails(dir, subscription string, day time.Time, details []*domain.ReservationDetail) (err error) {
+	return write(ReservationDetailsPath(dir, subscription, day), func(enc *json.Encoder) error {
+		return enc.Encode(details)
+	})
+}
+
+// ReadReservationDetails - Loads the archived reservation usage of a day
+func ReadReservationDetails(dir, subscription string, day time.Time) (details []*domain.ReservationDetail, err error) {
+	err = read(ReservationDetailsPath(dir, subscription, day), func(dec *json.Decoder) error {
+		return dec.Decode(&details)
+	})
+
+	return details, err
+}
+
+// WriteReservationTransactions - Archives the reservation purchases used for amortisation
+func WriteReservationTransactions(dir, subscription string, transactions []*domain.ReservationTransaction) (err error) {
+	return write(ReservationTransactionsPath(dir, subscription), func(enc *json.Encoder) error {
+		return enc.Encode(transactions)
+	})
+}
+
+// ReadReservationTransactions - Loads the archived reservation purchases
+func ReadReservationTransactions(dir, subscription string) (transactions []*domain.ReservationTransaction, err error) {
+	err = read(ReservationTransactionsPath(dir, subscription), func(dec *json.Decoder) error {
+		return dec.Decode(&transactions)
+	})
+
+	return transactions, err
+}
+
+func write(path string, encode func(enc *json.Encoder) error) (err error) {
+	file, err := output.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	if err := encode(json.NewEncoder(gz)); err != nil {
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	return file.Commit()
+}
+
+func read(path string, decode func(dec *json.Decoder) error) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	return decode(json.NewDecoder(gz))
+}
@@ -0,0 +1,111 @@
+package budget
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultThresholds - Alert percentages used when a budget does not specify any
+var DefaultThresholds = []float64{50, 80, 100}
+
+// MonthStart - Returns the first day of the month containing t
+func MonthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// Validate - Ensures every budget scope is an aggregation dimension, a budget scoped on anything else
+// would never match a point
+func Validate(budgets []*domain.Budget, dimensions []string) (err error) {
+	aggregated := make(map[string]bool)
+	for _, dimension := range dimensions {
+		aggregated[dimension] = true
+	}
+
+	for _, b := range budgets {
+		if len(b.Subscription) > 0 && !aggregated["Subscription"] && !aggregated["SubscriptionID"] {
+			return fmt.Errorf("budget %s: Subscription is not an aggregation dimension", b.Name)
+		}
+
+		if len(b.ResourceGroup) > 0 && !aggregated["ResourceGroup"] {
+			return fmt.Errorf("budget %s: ResourceGroup is not an aggregation dimension", b.Name)
+		}
+
+		if tagKey := fmt.Sprintf("_%s", strings.TrimPrefix(b.TagKey, "_")); len(b.TagKey) > 0 && !aggregated[tagKey] {
+			return fmt.Errorf("budget %s: tag %s is not an aggregation dimension", b.Name, tagKey)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate - Compares month-to-date spend of each budget with its thresholds and returns an alert
+// per threshold crossed. Alert IDs are stable within a month so each threshold fires once per period
+func Evaluate(points []*domain.Point, budgets []*domain.Budget, now time.Time) (alerts []*domain.Alert) {
+	start := MonthStart(now)
+	end := start.AddDate(0, 1, 0)
+
+	for _, b := range budgets {
+		if b.Amount <= 0 {
+			continue
+		}
+
+		total := decimal.Zero
+		for _, point := range points {
+			if point.Timestamp.Before(start) || !point.Timestamp.Before(end) || !matches(b, point) {
+				continue
+			}
+
+			total = total.Add(point.Cost)
+		}
+		spend := total.InexactFloat64()
+
+		thresholds := b.Thresholds
+		if len(thresholds) == 0 {
+			thresholds = DefaultThresholds
+		}
+
+		for _, threshold := range thresholds {
+			if spend < b.Amount*threshold/100 {
+				continue
+			}
+
+			alerts = append(alerts, &domain.Alert{
+				ID:        fmt.Sprintf("budget/%s/%s/%g", b.Name, start.Format("2006-01"), threshold),
+				Kind:      "budget",
+				Subject:   fmt.Sprintf("Budget %s reached %g%%", b.Name, threshold),
+				Message:   fmt.Sprintf("Month-to-date spend of %.2f for %s is %.1f%% of the %.2f budget", spend, start.Format("January 2006"), spend/b.Amount*100, b.Amount),
+				Timestamp: now,
+				Details: map[string]interface{}{
+					"budget":    b.Name,
+					"month":     start.Format("2006-01"),
+					"threshold": threshold,
+					"amount":    b.Amount,
+					"spend":     spend,
+				},
+			})
+		}
+	}
+
+	return alerts
+}
+
+func matches(b *domain.Budget, point *domain.Point) bool {
+	if len(b.Subscription) > 0 && !strings.EqualFold(b.Subscription, point.Subscription) && !strings.EqualFold(b.Subscription, point.SubscriptionID) {
+		return false
+	}
+
+	if len(b.ResourceGroup) > 0 && !strings.EqualFold(b.ResourceGroup, point.ResourceGroup) {
+		return false
+	}
+
+	if len(b.TagKey) > 0 && point.Tags[fmt.Sprintf("_%s", strings.TrimPrefix(b.TagKey, "_"))] != b.TagValue {
+		return false
+	}
+
+	return true
+}
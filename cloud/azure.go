@@ -2,6 +2,7 @@ package cloud
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
@@ -9,6 +10,8 @@ import (
 	"time"
 
 	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
 )
 
 type AzureClient struct {
@@ -83,15 +86,44 @@ func (z *AzureClient) GetGroups() (groupMap map[string]*domain.Group, err error)
 	return groupMap, nil
 }
 
+// GetSubscriptionTags - Tags set on the subscription itself. A refused request is an error rather
+// than an empty tier, which would silently send every inherited tag to its default
+func (z *AzureClient) GetSubscriptionTags() (tags map[string]interface{}, err error) {
+	baseURL, _ := url.ParseRequestURI("https://management.azure.com")
+	baseURL.Path = fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Resources/tags/default", z.config.SubscriptionID)
+
+	params := &url.Values{}
+	params.Add("api-version", "2021-04-01")
+	baseURL.RawQuery = params.Encode()
+
+	type jsonBody struct {
+		Properties struct {
+			Tags map[string]interface{} `json:"tags"`
+		} `json:"properties"`
+	}
+
+	var jb jsonBody
+	if err := httpGetJson(baseURL.String(), z.token.AccessToken, &jb); err != nil {
+		return nil, fmt.Errorf("subscription tags: %v", err)
+	}
+
+	tags = jb.Properties.Tags
+	if tags == nil {
+		tags = make(map[string]interface{})
+	}
+
+	return tags, nil
+}
+
 func (z *AzureClient) GetReadings(startDate, endDate time.Time) (ur []*domain.UsageRecord, err error) {
 	baseURL, _ := url.ParseRequestURI("https://management.azure.com")
 	baseURL.Path = fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Commerce/UsageAggregates", z.config.SubscriptionID)
 
 	params := &url.Values{}
 	params.Add("api-version", "2015-06-01-preview")
-	params.Add("reportedStartTime", startDate.Format(time.RFC3339))
-	params.Add("reportedEndTime", endDate.Format(time.RFC3339))
-	params.Add("aggregationGranulatiry", "daily")
+	params.Add("reportedStartTime", reportedTime(startDate, z.config.Granularity).Format(time.RFC3339))
+	params.Add("reportedEndTime", reportedTime(endDate, z.config.Granularity).Format(time.RFC3339))
+	params.Add("aggregationGranularity", granularity(z.config.Granularity))
 	params.Add("showDetails", "true")
 	baseURL.RawQuery = params.Encode()
 
@@ -110,21 +142,208 @@ func (z *AzureClient) GetReadings(startDate, endDate time.Time) (ur []*domain.Us
 	for len(jb.NextLink) > 0 {
 		log.Println("Retrieving Next Batch of Records")
 
+		next := jb.NextLink
 		jb = &jsonBody{}
-		if err = httpGetJson(jb.NextLink, z.token.AccessToken, &jb); err != nil {
+		if err = httpGetJson(next, z.token.AccessToken, &jb); err != nil {
 			return nil, err
 		}
 
 		ur = append(ur, jb.UsageRecords...)
 	}
 
-	if err := populateInstanceData(ur); err != nil {
+	if err := PopulateInstanceData(ur); err != nil {
 		return nil, err
 	}
 
 	return ur, nil
 }
 
+func (z *AzureClient) GetReservationTransactions(startDate, endDate time.Time) (transactions []*domain.ReservationTransaction, err error) {
+	if len(z.config.BillingAccountID) == 0 {
+		return nil, errors.New("reservation transactions require billingAccountId in the configuration")
+	}
+
+	baseURL, _ := url.ParseRequestURI("https://management.azure.com")
+	baseURL.Path = fmt.Sprintf("/providers/Microsoft.Billing/billingAccounts/%s/providers/Microsoft.Consumption/reservationTransactions", z.config.BillingAccountID)
+
+	params := &url.Values{}
+	params.Add("api-version", "2023-05-01")
+	params.Add("$filter", fmt.Sprintf("properties/eventDate ge %s AND properties/eventDate le %s", startDate.Format("2006-01-02"), endDate.Format("2006-01-02")))
+	baseURL.RawQuery = params.Encode()
+
+	type jsonBody struct {
+		Value []struct {
+			Properties *domain.ReservationTransaction `json:"properties"`
+		} `json:"value"`
+		NextLink string `json:"nextLink"`
+	}
+
+	next := baseURL.String()
+	for len(next) > 0 {
+		jb := &jsonBody{}
+		if err := httpGetJson(next, z.token.AccessToken, &jb); err != nil {
+			return nil, err
+		}
+
+		for _, v := range jb.Value {
+			transactions = append(transactions, v.Properties)
+		}
+
+		next = jb.NextLink
+	}
+
+	return transactions, nil
+}
+
+func (z *AzureClient) GetReservationDetails(startDate, endDate time.Time) (details []*domain.ReservationDetail, err error) {
+	if len(z.config.BillingAccountID) == 0 {
+		return nil, errors.New("reservation details require billingAccountId in the configuration")
+	}
+
+	baseURL, _ := url.ParseRequestURI("https://management.azure.com")
+	baseURL.Path = fmt.Sprintf("/providers/Microsoft.Billing/billingAccounts/%s/providers/Microsoft.Consumption/reservationDetails", z.config.BillingAccountID)
+
+	params := &url.Values{}
+	params.Add("api-version", "2023-05-01")
+	params.Add("startDate", startDate.Format("2006-01-02"))
+	params.Add("endDate", endDate.Format("2006-01-02"))
+	baseURL.RawQuery = params.Encode()
+
+	type jsonBody struct {
+		Value []struct {
+			Properties *domain.ReservationDetail `json:"properties"`
+		} `json:"value"`
+		NextLink string `json:"nextLink"`
+	}
+
+	next := baseURL.String()
+	for len(next) > 0 {
+		jb := &jsonBody{}
+		if err := httpGetJson(next, z.token.AccessToken, &jb); err != nil {
+			return nil, err
+		}
+
+		for _, v := range jb.Value {
+			details = append(details, v.Properties)
+		}
+
+		next = jb.NextLink
+	}
+
+	return details, nil
+}
+
+// invoicePeriod - Query period covering the UTC dates of the local days between startDate and endDate
+// (exclusive), matching the UTC dates the computed points are bucketed on
+func invoicePeriod(startDate, endDate time.Time) (from, to string) {
+	last := endDate.AddDate(0, 0, -1)
+
+	from = time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	to = time.Date(last.Year(), last.Month(), last.Day(), 23, 59, 59, 0, time.UTC).Format(time.RFC3339)
+
+	return from, to
+}
+
+// GetInvoiceLines - Actual cost of the subscription per meter category between startDate and endDate
+// (exclusive) from the Cost Management query API
+func (z *AzureClient) GetInvoiceLines(startDate, endDate time.Time) (lines []*domain.InvoiceLine, err error) {
+	baseURL, _ := url.ParseRequestURI("https://management.azure.com")
+	baseURL.Path = fmt.Sprintf("/subscriptions/%s/providers/Microsoft.CostManagement/query", z.config.SubscriptionID)
+
+	params := &url.Values{}
+	params.Add("api-version", "2023-03-01")
+	baseURL.RawQuery = params.Encode()
+
+	from, to := invoicePeriod(startDate, endDate)
+	query := map[string]interface{}{
+		"type":      "ActualCost",
+		"timeframe": "Custom",
+		"timePeriod": map[string]string{
+			"from": from,
+			"to":   to,
+		},
+		"dataset": map[string]interface{}{
+			"granularity": "None",
+			"aggregation": map[string]interface{}{
+				"totalCost": map[string]string{"name": "Cost", "function": "Sum"},
+			},
+			"grouping": []map[string]string{
+				{"type": "Dimension", "name": "MeterCategory"},
+			},
+		},
+	}
+
+	type jsonBody struct {
+		Properties struct {
+			NextLink string `json:"nextLink"`
+			Columns  []struct {
+				Name string `json:"name"`
+				Type string `json:"type"`
+			} `json:"columns"`
+			Rows [][]interface{} `json:"rows"`
+		} `json:"properties"`
+	}
+
+	next := baseURL.String()
+	for len(next) > 0 {
+		var jb jsonBody
+		if err := httpPostJsonBody(next, z.token.AccessToken, query, &jb); err != nil {
+			return nil, err
+		}
+
+		costIndex, categoryIndex := -1, -1
+		for i, column := range jb.Properties.Columns {
+			switch {
+			case strings.EqualFold(column.Name, "Cost"), strings.EqualFold(column.Name, "PreTaxCost"):
+				costIndex = i
+			case strings.EqualFold(column.Name, "MeterCategory"):
+				categoryIndex = i
+			}
+		}
+
+		if costIndex < 0 || categoryIndex < 0 {
+			return nil, errors.New("cost management query returned no cost or meter category column")
+		}
+
+		for _, row := range jb.Properties.Rows {
+			cost, ok := row[costIndex].(float64)
+			if !ok {
+				continue
+			}
+			category, _ := row[categoryIndex].(string)
+
+			lines = append(lines, &domain.InvoiceLine{
+				SubscriptionID: z.config.SubscriptionID,
+				Subscription:   z.config.Subscription,
+				MeterCategory:  category,
+				Cost:           decimal.NewFromFloat(cost),
+			})
+		}
+
+		next = jb.Properties.NextLink
+	}
+
+	return lines, nil
+}
+
+func granularity(value string) string {
+	if strings.EqualFold(value, "hourly") {
+		return "Hourly"
+	}
+
+	return "Daily"
+}
+
+// reportedTime - Daily usage is reported per UTC day, so daily requests use the UTC midnight of the
+// local date while hourly requests use the exact instant
+func reportedTime(t time.Time, value string) time.Time {
+	if strings.EqualFold(value, "hourly") {
+		return t.UTC()
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
 func (z *AzureClient) login() (err error) {
 	baseURL, _ := url.ParseRequestURI("https://login.microsoftonline.com")
 	baseURL.Path = fmt.Sprintf("%s/oauth2/token", z.config.TenantID)
@@ -145,7 +364,8 @@ func (z *AzureClient) login() (err error) {
 	return nil
 }
 
-func populateInstanceData(records []*domain.UsageRecord) (err error) {
+// PopulateInstanceData - Parses the instance data of each record and derives its resource group and resource
+func PopulateInstanceData(records []*domain.UsageRecord) (err error) {
 	for _, record := range records {
 		if err := json.Unmarshal([]byte(record.Properties.InstanceDataText), &record.Properties.InstanceData); err != nil {
 			continue
@@ -0,0 +1,25 @@
+package cloud
+
+import (
+	"testing"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+func TestInvoicePeriodUsesLocalDates(t *testing.T) {
+	for _, timeZone := range []string{"UTC", "Africa/Johannesburg", "America/New_York", "Asia/Kolkata"} {
+		config := &domain.Config{TimeZone: timeZone}
+		loc, err := config.Location()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		startDate := time.Date(2026, 10, 1, 0, 0, 0, 0, loc)
+		from, to := invoicePeriod(startDate, startDate.AddDate(0, 1, 0))
+
+		if from != "2026-10-01T00:00:00Z" || to != "2026-10-31T23:59:59Z" {
+			t.Errorf("%s: expected the UTC dates of October, got %s to %s", timeZone, from, to)
+		}
+	}
+}
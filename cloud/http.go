@@ -1,6 +1,7 @@
 package cloud
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -52,7 +53,9 @@ func httpPostJson(url string, values url.Values, v interface{}) (err error) {
 
 func httpGetJson(url, accessToken string, v interface{}) (err error) {
 	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	if len(accessToken) > 0 {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	}
 
 	tr := &http.Transport{
 		DialContext: (&net.Dialer{
@@ -74,5 +77,42 @@ func httpGetJson(url, accessToken string, v interface{}) (err error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
 	return json.NewDecoder(resp.Body).Decode(&v)
 }
+
+func httpPostJsonBody(url, accessToken string, body interface{}, v interface{}) (err error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, _ := http.NewRequest("POST", url, bytes.NewReader(data))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	client := &http.Client{
+		Timeout: 5 * time.Minute,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != 200 {
+		return errors.New(string(result))
+	}
+
+	return json.Unmarshal(result, &v)
+}
@@ -0,0 +1,252 @@
+package cloud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/output"
+)
+
+// RetailPricesURL - Public endpoint of the Azure Retail Prices API
+const RetailPricesURL = "https://prices.azure.com/api/retail/prices"
+
+// DefaultPriceCacheHours - Age after which cached retail prices are fetched again when not configured
+const DefaultPriceCacheHours = 24
+
+// RetailPrice - Price item as returned by the Retail Prices API
+type RetailPrice struct {
+	CurrencyCode         string    `json:"currencyCode"`
+	TierMinimumUnits     float64   `json:"tierMinimumUnits"`
+	RetailPrice          float64   `json:"retailPrice"`
+	UnitPrice            float64   `json:"unitPrice"`
+	ArmRegionName        string    `json:"armRegionName"`
+	Location             string    `json:"location"`
+	EffectiveStartDate   time.Time `json:"effectiveStartDate"`
+	MeterID              string    `json:"meterId"`
+	MeterName            string    `json:"meterName"`
+	ProductID            string    `json:"productId"`
+	SkuID                string    `json:"skuId"`
+	ProductName          string    `json:"productName"`
+	SkuName              string    `json:"skuName"`
+	ServiceName          string    `json:"serviceName"`
+	ServiceID            string    `json:"serviceId"`
+	ServiceFamily        string    `json:"serviceFamily"`
+	UnitOfMeasure        string    `json:"unitOfMeasure"`
+	Type                 string    `json:"type"`
+	IsPrimaryMeterRegion bool      `json:"isPrimaryMeterRegion"`
+	ArmSkuName           string    `json:"armSkuName"`
+}
+
+// RetailPricesPage - Page of price items, NextPageLink is empty on the last page
+type RetailPricesPage struct {
+	BillingCurrency    string         `json:"BillingCurrency"`
+	CustomerEntityID   string         `json:"CustomerEntityId"`
+	CustomerEntityType string         `json:"CustomerEntityType"`
+	Items              []*RetailPrice `json:"Items"`
+	NextPageLink       string         `json:"NextPageLink"`
+	Count              int            `json:"Count"`
+}
+
+// RetailPriceClient - Loads meters from the unauthenticated Retail Prices API, keeping a local cache
+type RetailPriceClient struct {
+	config    *domain.Config
+	baseURL   string
+	cachePath string
+}
+
+type retailPriceCache struct {
+	Currency string                   `json:"currency"`
+	Filter   string                   `json:"filter"`
+	Fetched  time.Time                `json:"fetched"`
+	Meters   map[string]*domain.Meter `json:"meters"`
+}
+
+func NewRetailPriceClient(config *domain.Config) *RetailPriceClient {
+	baseURL := config.RetailPricesURL
+	if len(baseURL) == 0 {
+		baseURL = RetailPricesURL
+	}
+
+	dir := config.StateDir
+	if len(dir) == 0 {
+		dir = output.Dir(config.OutputDir)
+	}
+
+	return &RetailPriceClient{
+		config:    config,
+		baseURL:   baseURL,
+		cachePath: filepath.Join(dir, fmt.Sprintf("_retail_prices_%s.json", strings.ToLower(config.Currency))),
+	}
+}
+
+// GetMeters - Returns the consumption meters from the cache while it is fresh, otherwise from the API.
+// A stale cache is used when the API can not be reached or returns no prices, without a cache that
+// is an error
+func (r *RetailPriceClient) GetMeters() (meterMap map[string]*domain.Meter, err error) {
+	cache, err := r.readCache()
+	if err != nil {
+		log.Printf("Ignoring retail price cache: %v\n", err)
+	}
+
+	maxAge := time.Duration(r.config.PriceCacheHours) * time.Hour
+	if r.config.PriceCacheHours <= 0 {
+		maxAge = DefaultPriceCacheHours * time.Hour
+	}
+
+	if cache != nil && time.Since(cache.Fetched) < maxAge {
+		log.Printf("Using retail prices cached at %s\n", cache.Fetched)
+		return cache.Meters, nil
+	}
+
+	meterMap, err = r.fetch()
+	if err != nil || len(meterMap) == 0 {
+		if cache != nil {
+			log.Printf("Using stale retail prices cached at %s: %v\n", cache.Fetched, err)
+			return cache.Meters, nil
+		}
+
+		if err == nil {
+			err = errors.New("retail prices API returned no consumption prices")
+		}
+
+		return nil, err
+	}
+
+	cache = &retailPriceCache{
+		Currency: r.config.Currency,
+		Filter:   r.config.RetailPricesFilter,
+		Fetched:  time.Now(),
+		Meters:   meterMap,
+	}
+	if err := r.writeCache(cache); err != nil {
+		return nil, err
+	}
+
+	return meterMap, nil
+}
+
+func (r *RetailPriceClient) fetch() (meterMap map[string]*domain.Meter, err error) {
+	baseURL, err := url.Parse(r.baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := "priceType eq 'Consumption'"
+	if len(r.config.RetailPricesFilter) > 0 {
+		filter = fmt.Sprintf("%s and (%s)", filter, r.config.RetailPricesFilter)
+	}
+
+	params := baseURL.Query()
+	params.Set("api-version", "2023-01-01-preview")
+	params.Set("$filter", filter)
+	if len(r.config.Currency) > 0 {
+		params.Set("currencyCode", fmt.Sprintf("'%s'", r.config.Currency))
+	}
+	baseURL.RawQuery = params.Encode()
+
+	meterMap = make(map[string]*domain.Meter)
+	effective := make(map[string]time.Time)
+
+	next := baseURL.String()
+	for page := 1; len(next) > 0; page++ {
+		log.Printf("Retrieving Retail Prices page %d\n", page)
+
+		var jb RetailPricesPage
+		if err := httpGetJson(next, "", &jb); err != nil {
+			return nil, err
+		}
+
+		for _, item := range jb.Items {
+			addRetailPrice(meterMap, effective, item)
+		}
+
+		next = jb.NextPageLink
+	}
+
+	return meterMap, nil
+}
+
+// addRetailPrice - Normalises a price item into the RateCard shape, one rate per tier keyed by its
+// minimum units. The most recent effective price of a tier wins
+func addRetailPrice(meterMap map[string]*domain.Meter, effective map[string]time.Time, item *RetailPrice) {
+	if len(item.MeterID) == 0 {
+		return
+	}
+
+	meter, found := meterMap[item.MeterID]
+	if !found {
+		meter = &domain.Meter{
+			MeterID:          item.MeterID,
+			MeterName:        item.MeterName,
+			MeterCategory:    item.ServiceName,
+			MeterSubCategory: item.ProductName,
+			MeterRegion:      item.Location,
+			MeterRates:       make(map[string]float64),
+			MeterStatus:      "Active",
+			UnitOfMeasure:    item.UnitOfMeasure,
+			Unit:             item.UnitOfMeasure,
+		}
+		meterMap[item.MeterID] = meter
+	}
+
+	tier := strconv.FormatFloat(item.TierMinimumUnits, 'f', -1, 64)
+	key := fmt.Sprintf("%s/%s", item.MeterID, tier)
+	if date, found := effective[key]; found && item.EffectiveStartDate.Before(date) {
+		return
+	}
+	effective[key] = item.EffectiveStartDate
+
+	meter.MeterRates[tier] = item.RetailPrice
+	if item.EffectiveStartDate.After(meter.EffectiveDate) {
+		meter.EffectiveDate = item.EffectiveStartDate
+	}
+}
+
+func (r *RetailPriceClient) readCache() (cache *retailPriceCache, err error) {
+	data, err := ioutil.ReadFile(r.cachePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, err
+	}
+
+	if cache.Currency != r.config.Currency || cache.Filter != r.config.RetailPricesFilter {
+		return nil, nil
+	}
+
+	return cache, nil
+}
+
+func (r *RetailPriceClient) writeCache(cache *retailPriceCache) (err error) {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	file, err := output.Create(r.cachePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	return file.Commit()
+}
@@ -0,0 +1,166 @@
+package cloud_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/cloud"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/cloud/retailtest"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+func retailItems(count int) (items []*cloud.RetailPrice) {
+	for i := 0; i < count; i++ {
+		items = append(items, &cloud.RetailPrice{
+			MeterID:            fmt.Sprintf("meter-%03d", i),
+			MeterName:          fmt.Sprintf("Meter %d", i),
+			ServiceName:        "Virtual Machines",
+			RetailPrice:        float64(i) / 100,
+			Type:               "Consumption",
+			EffectiveStartDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+
+	return items
+}
+
+func retailConfig(t *testing.T, url string) *domain.Config {
+	return &domain.Config{
+		Currency:        "USD",
+		StateDir:        t.TempDir(),
+		RetailPricesURL: url,
+		PriceCacheHours: 1,
+	}
+}
+
+func TestRetailPricesPaging(t *testing.T) {
+	items := retailItems(250)
+	items = append(items, &cloud.RetailPrice{MeterID: "reserved", Type: "Reservation"})
+
+	server := retailtest.NewServer(items, 100)
+	defer server.Close()
+
+	meters, err := cloud.NewRetailPriceClient(retailConfig(t, server.URL)).GetMeters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(meters) != 250 {
+		t.Fatalf("expected 250 meters across 3 pages, got %d", len(meters))
+	}
+
+	if rate := meters["meter-249"].MeterRates["0"]; rate != 2.49 {
+		t.Errorf("expected rate 2.49 for the last meter, got %v", rate)
+	}
+
+	if _, found := meters["reserved"]; found {
+		t.Error("expected reservation prices to be filtered out")
+	}
+}
+
+func TestRetailPricesFilterEncoding(t *testing.T) {
+	var filter, currency string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		filter = req.URL.Query().Get("$filter")
+		currency = req.URL.Query().Get("currencyCode")
+		json.NewEncoder(w).Encode(&cloud.RetailPricesPage{Items: retailItems(1)})
+	}))
+	defer server.Close()
+
+	config := retailConfig(t, server.URL)
+	config.Currency = "ZAR"
+	config.RetailPricesFilter = "armRegionName eq 'southafricanorth' and serviceName eq 'Virtual Machines'"
+
+	if _, err := cloud.NewRetailPriceClient(config).GetMeters(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "priceType eq 'Consumption' and (armRegionName eq 'southafricanorth' and serviceName eq 'Virtual Machines')"
+	if filter != expected {
+		t.Errorf("expected filter %q, got %q", expected, filter)
+	}
+
+	if currency != "'ZAR'" {
+		t.Errorf("expected quoted currency code, got %q", currency)
+	}
+}
+
+func TestRetailPricesCache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(&cloud.RetailPricesPage{Items: retailItems(requests)})
+	}))
+	defer server.Close()
+
+	config := retailConfig(t, server.URL)
+
+	for i := 0; i < 2; i++ {
+		meters, err := cloud.NewRetailPriceClient(config).GetMeters()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(meters) != 1 || requests != 1 {
+			t.Fatalf("expected the fresh cache to be used, got %d meters after %d requests", len(meters), requests)
+		}
+	}
+
+	path := filepath.Join(config.StateDir, "_retail_prices_usd.json")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cache map[string]interface{}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		t.Fatal(err)
+	}
+	cache["fetched"] = time.Now().Add(-2 * time.Hour)
+
+	if data, err = json.Marshal(cache); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	meters, err := cloud.NewRetailPriceClient(config).GetMeters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(meters) != 2 || requests != 2 {
+		t.Fatalf("expected the expired cache to be refreshed, got %d meters after %d requests", len(meters), requests)
+	}
+}
+
+func TestRetailPricesErrors(t *testing.T) {
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if status != http.StatusOK {
+			http.Error(w, "unavailable", status)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&cloud.RetailPricesPage{})
+	}))
+	defer server.Close()
+
+	config := retailConfig(t, server.URL)
+
+	if _, err := cloud.NewRetailPriceClient(config).GetMeters(); err == nil {
+		t.Error("expected an error for a failed request without a cache")
+	}
+
+	status = http.StatusOK
+	if _, err := cloud.NewRetailPriceClient(config).GetMeters(); err == nil {
+		t.Error("expected an error for an empty price list without a cache")
+	}
+}
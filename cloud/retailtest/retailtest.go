@@ -0,0 +1,122 @@
+// Package retailtest provides a local stand-in for the Azure Retail Prices API so the retail pricing
+// source can be exercised without network access
+package retailtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/cloud"
+)
+
+// DefaultPageSize - Items per page, matching the API
+const DefaultPageSize = 100
+
+var clause = regexp.MustCompile(`^(\w+) eq '([^']*)'$`)
+
+var fields = map[string]func(item *cloud.RetailPrice) string{
+	"priceType":     func(item *cloud.RetailPrice) string { return item.Type },
+	"meterId":       func(item *cloud.RetailPrice) string { return item.MeterID },
+	"meterName":     func(item *cloud.RetailPrice) string { return item.MeterName },
+	"serviceName":   func(item *cloud.RetailPrice) string { return item.ServiceName },
+	"serviceFamily": func(item *cloud.RetailPrice) string { return item.ServiceFamily },
+	"productName":   func(item *cloud.RetailPrice) string { return item.ProductName },
+	"skuName":       func(item *cloud.RetailPrice) string { return item.SkuName },
+	"armRegionName": func(item *cloud.RetailPrice) string { return item.ArmRegionName },
+	"location":      func(item *cloud.RetailPrice) string { return item.Location },
+}
+
+// NewServer - Starts a server that pages through items with NextPageLink and applies $filter
+// expressions made of eq clauses joined by and. The caller closes the server
+func NewServer(items []*cloud.RetailPrice, pageSize int) *httptest.Server {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+
+		matched, err := filter(items, query.Get("$filter"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		skip, _ := strconv.Atoi(query.Get("$skip"))
+		if skip > len(matched) {
+			skip = len(matched)
+		}
+
+		end := skip + pageSize
+		if end > len(matched) {
+			end = len(matched)
+		}
+
+		page := &cloud.RetailPricesPage{
+			BillingCurrency:    "USD",
+			CustomerEntityID:   "Default",
+			CustomerEntityType: "Retail",
+			Items:              matched[skip:end],
+			Count:              end - skip,
+		}
+		if currency := strings.Trim(query.Get("currencyCode"), "'"); len(currency) > 0 {
+			page.BillingCurrency = currency
+		}
+
+		if end < len(matched) {
+			query.Set("$skip", strconv.Itoa(end))
+			page.NextPageLink = fmt.Sprintf("%s%s?%s", server.URL, req.URL.Path, query.Encode())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}))
+
+	return server
+}
+
+func filter(items []*cloud.RetailPrice, expression string) (matched []*cloud.RetailPrice, err error) {
+	type condition struct {
+		field func(item *cloud.RetailPrice) string
+		value string
+	}
+
+	var conditions []condition
+	if len(strings.TrimSpace(expression)) > 0 {
+		for _, part := range strings.Split(expression, " and ") {
+			part = strings.Trim(strings.TrimSpace(part), "()")
+
+			m := clause.FindStringSubmatch(part)
+			if m == nil {
+				return nil, fmt.Errorf("unsupported filter clause: %s", part)
+			}
+
+			field, ok := fields[m[1]]
+			if !ok {
+				return nil, fmt.Errorf("unsupported filter field: %s", m[1])
+			}
+
+			conditions = append(conditions, condition{field: field, value: m[2]})
+		}
+	}
+
+	matched = make([]*cloud.RetailPrice, 0, len(items))
+	for _, item := range items {
+		ok := true
+		for _, c := range conditions {
+			ok = ok && strings.EqualFold(c.field(item), c.value)
+		}
+
+		if ok {
+			matched = append(matched, item)
+		}
+	}
+
+	return matched, nil
+}
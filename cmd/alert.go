@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/aggregate"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/anomaly"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/budget"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/forecast"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/notify"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/state"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// extendWindow - Moves fromDate back to cover the month-to-date spend budgets need, the history
+// forecasts are fitted on and the start of every rollup period fromDate falls in that completes by toDate
+func extendWindow(config *domain.Config, fromDate, toDate time.Time) time.Time {
+	now := time.Now().In(fromDate.Location())
+	start := fromDate
+
+	if len(config.Budgets) > 0 {
+		if monthStart := budget.MonthStart(now); monthStart.Before(start) {
+			start = monthStart
+		}
+	}
+
+	if config.Forecast != nil {
+		if windowStart := forecast.WindowStart(config.Forecast, now); windowStart.Before(start) {
+			start = windowStart
+		}
+	}
+
+	for _, period := range config.Rollups {
+		periodStart := aggregate.RollupStart(fromDate, period, config)
+		if periodStart.Before(start) && !aggregate.RollupEnd(periodStart, period).After(toDate) {
+			start = periodStart
+		}
+	}
+
+	if start.Before(fromDate) {
+		log.Printf("Extending FromDate to %s for budgets, forecasts and rollups\n", start)
+	}
+
+	return start
+}
+
+// analyse - Runs the budget and anomaly stages over the extracted points and notifies their alerts
+func analyse(c client.Client, config *domain.Config, points []*domain.Point, now time.Time) (err error) {
+	if len(config.Budgets) == 0 && config.Anomaly == nil {
+		return nil
+	}
+
+	s, err := state.Load(state.Path(config))
+	if err != nil {
+		return err
+	}
+
+	var alerts []*domain.Alert
+
+	if len(config.Budgets) > 0 {
+		log.Println("Checking Budgets")
+		alerts = append(alerts, budget.Evaluate(points, config.Budgets, now)...)
+	}
+
+	if config.Anomaly != nil {
+		log.Println("Detecting Anomalies")
+		anomalies := anomaly.Detect(points, config.Anomaly, s.Baselines)
+		log.Printf("Anomaly Count: %d\n", len(anomalies))
+
+		if err := WriteAnomalies(c, config, fmt.Sprintf("%s_anomaly", config.InfluxMeasurement), anomalies); err != nil {
+			return err
+		}
+
+		for _, a := range anomalies {
+			alerts = append(alerts, anomaly.Alert(a))
+		}
+	}
+
+	var dispatchErr error
+	if len(alerts) > 0 {
+		notifiers, err := notify.NewAll(config.Notifiers)
+		if err != nil {
+			return err
+		}
+
+		if len(notifiers) == 0 {
+			log.Printf("No notifiers configured, %d Alerts not sent\n", len(alerts))
+		}
+
+		var sent int
+		sent, dispatchErr = notify.Dispatch(notifiers, alerts, s)
+		log.Printf("Sent %d of %d Alerts\n", sent, len(alerts))
+	}
+
+	if err := s.Save(); err != nil {
+		return err
+	}
+
+	if dispatchErr != nil {
+		return fmt.Errorf("alert delivery failed: %v", dispatchErr)
+	}
+
+	return nil
+}
@@ -1,22 +1,32 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"bitbucket.org/corneilebritz/cloudcostcalculator/aggregate"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/allocate"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/amortise"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/archive"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/budget"
 	"bitbucket.org/corneilebritz/cloudcostcalculator/cloud"
-	"bitbucket.org/corneilebritz/cloudcostcalculator/csv"
 	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/forecast"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/fx"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/money"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/notify"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/output"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/pricing"
 	"bitbucket.org/corneilebritz/cloudcostcalculator/tags"
 
 	client "github.com/influxdata/influxdb1-client/v2"
+	"github.com/shopspring/decimal"
 )
 
 var (
@@ -45,18 +55,18 @@ func LoadConfig(path string) (config *domain.Config, err error) {
 	return config, nil
 }
 
-func calcDates() (fromDate, toDate time.Time) {
-	now := time.Now()
+func calcDates(loc *time.Location) (fromDate, toDate time.Time) {
+	now := time.Now().In(loc)
 	startDate := now.AddDate(0, 0, -1**daysBack)
 	endDate := now.AddDate(0, 0, 2)
 
 	if (len(*fromDateText) != 0) && (len(*toDateText) != 0) {
-		startDate, _ = time.Parse("2006-01-02", *fromDateText)
-		endDate, _ = time.Parse("2006-01-02", *toDateText)
+		startDate, _ = time.ParseInLocation("2006-01-02", *fromDateText, loc)
+		endDate, _ = time.ParseInLocation("2006-01-02", *toDateText, loc)
 	}
 
-	fromDate = time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, time.UTC)
-	toDate = time.Date(endDate.Year(), endDate.Month(), endDate.Day(), 0, 0, 0, 0, time.UTC)
+	fromDate = time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, loc)
+	toDate = time.Date(endDate.Year(), endDate.Month(), endDate.Day(), 0, 0, 0, 0, loc)
 
 	return fromDate, toDate
 }
@@ -64,53 +74,185 @@ func calcDates() (fromDate, toDate time.Time) {
 func main() {
 	flag.Parse()
 
-	fromDate, toDate := calcDates()
+	log.Printf("Loading configuration from %s\n", *configPath)
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(config.PricingFile) > 0 {
+		log.Printf("Loading pricing rules from %s\n", config.PricingFile)
+		rules, err := pricing.Load(config.PricingFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		config.PricingRules = append(config.PricingRules, rules...)
+	}
+
+	loc, err := config.Location()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fromDate, toDate := calcDates(loc)
 
 	log.Printf("FromDate: %s, ToDate: %s", fromDate, toDate)
 
-	log.Printf("Loading configuration from %s\n", *configPath)
-	config, err := LoadConfig(*configPath)
+	if err := aggregate.ValidateDimensions(aggregate.Dimensions(config)); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := pricing.Validate(config.PricingRules); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := tags.ValidatePrecedence(config.TagPrecedence); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := tags.NewEngine(config); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := money.NewRounder(config); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := output.ValidateFormats(config.OutputFormats); err != nil {
+		log.Fatal(err)
+	}
+
+	switch config.PricingSource {
+	case "", "ratecard", "retail":
+	default:
+		log.Fatalf("Unknown pricing source: %s\n", config.PricingSource)
+	}
+
+	if err := aggregate.ValidateRollups(config); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := forecast.Validate(config); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := allocate.Validate(config.AllocationRules, aggregate.Dimensions(config)); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := budget.Validate(config.Budgets, aggregate.Dimensions(config)); err != nil {
+		log.Fatal(err)
+	}
+
+	if len(config.ReportingCurrencies) > 0 {
+		if len(config.Currency) == 0 {
+			log.Fatal("reporting currencies require currency in the configuration")
+		}
+
+		if _, err := fx.New(config.FX); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if _, err := notify.NewAll(config.Notifiers); err != nil {
+		log.Fatal(err)
+	}
+
+	switch command := flag.Arg(0); command {
+	case "", "extract":
+		err = runExtract(config, extendWindow(config, fromDate, toDate), toDate)
+	case "replay":
+		err = runReplay(config, extendWindow(config, fromDate, toDate), toDate)
+	case "report":
+		err = runReport(config, loc)
+	case "reconcile":
+		err = runReconcile(config, loc)
+	case "tags":
+		err = runTags(config, fromDate, toDate)
+	default:
+		log.Fatalf("Unknown command: %s\n", command)
+	}
+
 	if err != nil {
 		log.Fatal(err)
 	}
+}
 
+func runExtract(config *domain.Config, fromDate, toDate time.Time) (err error) {
 	log.Println("Creating Azure Client")
 	azureClient, err := cloud.NewAzureClient(config)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	log.Println("Loading Groups")
 	groupMap, err := azureClient.GetGroups()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	log.Println("Connecting to InfluxDB")
-	c, err := client.NewHTTPClient(client.HTTPConfig{
-		Addr: config.InfluxHost,
-	})
+	log.Println("Loading Subscription Tags")
+	subscriptionTags, err := azureClient.GetSubscriptionTags()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	src := withPricing(config, azureClient)
+
+	if len(config.ArchiveDir) > 0 {
+		log.Printf("Archiving to %s\n", config.ArchiveDir)
+		if err := archive.WriteGroups(config.ArchiveDir, config.Subscription, groupMap); err != nil {
+			return err
+		}
+
+		if err := archive.WriteSubscriptionTags(config.ArchiveDir, config.Subscription, subscriptionTags); err != nil {
+			return err
+		}
+
+		src = &archivingSource{
+			source:       src,
+			dir:          config.ArchiveDir,
+			subscription: config.Subscription,
+		}
+	}
+
+	c, err := connectInflux(config)
+	if err != nil {
+		return err
 	}
 	defer c.Close()
 
 	log.Printf("Extracting Azure Costs: %s\n", config.Subscription)
-	if err := ExtractData(azureClient, groupMap, config, fromDate, toDate, c); err != nil {
-		log.Fatal(err)
-	}
+	return ExtractData(src, groupMap, subscriptionTags, config, fromDate, toDate, c, false)
 }
 
-func ExtractData(cloudClient *cloud.AzureClient, groupMap map[string]*domain.Group, config *domain.Config, fromDate, toDate time.Time, c client.Client) (err error) {
-	outPath := fmt.Sprintf("data/_%s.csv", config.Subscription)
-	outFile, err := os.Create(outPath)
+func connectInflux(config *domain.Config) (c client.Client, err error) {
+	log.Println("Connecting to InfluxDB")
+	return client.NewHTTPClient(client.HTTPConfig{
+		Addr: config.InfluxHost,
+	})
+}
+
+func ExtractData(cloudClient source, groupMap map[string]*domain.Group, subscriptionTags map[string]interface{}, config *domain.Config, fromDate, toDate time.Time, c client.Client, replay bool) (err error) {
+	exp, err := newExporter(config, fromDate, toDate)
 	if err != nil {
 		return err
 	}
-	defer outFile.Close()
-	outWriter := bufio.NewWriter(outFile)
+	defer exp.Close()
 
-	csv.WriteHeaders(outWriter)
+	startDate := fromDate
+	var extracted []*domain.Point
+	var recordCount, unpricedCount int
+
+	normaliser := tags.NewNormaliser(config)
+	tags.NormaliseGroups(groupMap, normaliser)
+	subscriptionTags = normaliser.Tags(subscriptionTags)
+
+	engine, err := tags.NewEngine(config)
+	if err != nil {
+		return err
+	}
 
 	var meters map[string]*domain.Meter
 	retryCount := 3
@@ -129,13 +271,32 @@ func ExtractData(cloudClient *cloud.AzureClient, groupMap map[string]*domain.Gro
 	}
 	log.Printf("Meter Count: %d\n", len(meters))
 
+	var converter fx.Provider
+	if len(config.ReportingCurrencies) > 0 {
+		if converter, err = fx.New(config.FX); err != nil {
+			return err
+		}
+	}
+
+	var amortiser *amortise.Amortiser
+	if config.Amortisation {
+		log.Println("Loading Reservation Transactions")
+		transactions, err := cloudClient.GetReservationTransactions(fromDate.AddDate(-5, 0, 0), toDate)
+		if err != nil {
+			return err
+		}
+		log.Printf("Reservation Transaction Count: %d\n", len(transactions))
+
+		amortiser = amortise.NewAmortiser(config, transactions)
+	}
+
 	for fromDate.Before(toDate) {
 		var usageRecords []*domain.UsageRecord
 
 		retryCount := 3
 		for retryCount > 0 {
 			log.Printf("Retrieving Readings for %s: Attempt %d\n", fromDate, retryCount)
-			usageRecords, err = cloudClient.GetReadings(fromDate, fromDate.Add(24*time.Hour))
+			usageRecords, err = cloudClient.GetReadings(fromDate, fromDate.AddDate(0, 0, 1))
 			if err != nil && retryCount == 1 {
 				return err
 			}
@@ -148,59 +309,308 @@ func ExtractData(cloudClient *cloud.AzureClient, groupMap map[string]*domain.Gro
 		}
 		log.Printf("Reading Count: %d\n", len(usageRecords))
 
-		tags.ApplyDefaults(usageRecords, groupMap, config.TagDefaults)
+		tags.Normalise(usageRecords, normaliser)
+		tags.ApplyDefaults(usageRecords, groupMap, subscriptionTags, config)
+		engine.Apply(usageRecords)
 
 		log.Println("Calculating Costs")
-		CalculateCosts(usageRecords, config, meters)
+		unpriced := CalculateCosts(usageRecords, config, meters)
+		recordCount += len(usageRecords)
+		unpricedCount += len(unpriced)
+
+		if len(unpriced) > 0 {
+			unpricedMeters := pricing.Unpriced(unpriced, config, fromDate)
+			for _, meter := range unpricedMeters {
+				log.Printf("Unpriced Meter %s (%s, %s): %d records\n", meter.MeterID, meter.MeterName, meter.MeterCategory, meter.Records)
+			}
 
-		log.Println("Aggregating Records")
-		points := aggregate.AggregateData(usageRecords, config)
+			// Checked before the day is written, days before it are already in InfluxDB while the
+			// export files are discarded
+			percent := float64(len(unpriced)) / float64(len(usageRecords)) * 100
+			if config.MaxUnpricedPercent > 0 && percent > config.MaxUnpricedPercent {
+				return fmt.Errorf("%.2f%% of records for %s are unpriced, above the maximum of %.2f%%", percent, fromDate.Format("2006-01-02"), config.MaxUnpricedPercent)
+			}
 
-		log.Println("Writing Records")
-		csv.WriteLines(outWriter, points)
+			if err := exp.WriteUnpriced(unpricedMeters); err != nil {
+				return err
+			}
 
-		bp, err := client.NewBatchPoints(client.BatchPointsConfig{
-			Database:  config.InfluxDB,
-			Precision: "h",
-		})
+			if err := WriteUnpriced(c, config, fmt.Sprintf("%s_unpriced", config.InfluxMeasurement), unpricedMeters); err != nil {
+				return err
+			}
+		}
+
+		if amortiser != nil {
+			log.Printf("Retrieving Reservation Details for %s\n", fromDate)
+			details, err := cloudClient.GetReservationDetails(fromDate, fromDate.AddDate(0, 0, 1))
+			if err != nil {
+				return err
+			}
+
+			log.Println("Amortising Reservations")
+			usageRecords = append(usageRecords, amortiser.Apply(usageRecords, fromDate, details)...)
+		}
+
+		log.Println("Aggregating Records")
+		points, err := aggregate.AggregateData(usageRecords, config)
 		if err != nil {
 			return err
 		}
 
-		log.Println("Creating Metrics")
-		for _, point := range points {
-			if err := CreatePoint(bp, config.InfluxMeasurement, point); err != nil {
+		sorted := aggregate.SortedPoints(points)
+		if err := aggregate.Reconcile(usageRecords, sorted); err != nil {
+			return err
+		}
+
+		if converter != nil {
+			log.Printf("Converting Costs to %s\n", strings.Join(config.ReportingCurrencies, ", "))
+			if err := fx.Convert(sorted, converter, config.ReportingCurrencies); err != nil {
 				return err
 			}
 		}
+		extracted = append(extracted, sorted...)
+
+		log.Println("Writing Records")
+		if err := exp.Write(usageRecords, sorted); err != nil {
+			return err
+		}
 
 		log.Println("Writing Metrics")
-		if err := c.Write(bp); err != nil {
+		if err := WritePoints(c, config, config.InfluxMeasurement, sorted); err != nil {
 			return err
 		}
 
-		fromDate = fromDate.Add(24 * time.Hour)
+		if len(config.AllocationRules) > 0 {
+			log.Println("Allocating Shared Costs")
+			allocated := allocate.Allocate(sorted, config.AllocationRules)
+			if err := allocate.Reconcile(sorted, allocated); err != nil {
+				return err
+			}
+
+			if err := WritePoints(c, config, fmt.Sprintf("%s_allocated", config.InfluxMeasurement), allocated); err != nil {
+				return err
+			}
+		}
+
+		fromDate = fromDate.AddDate(0, 0, 1)
 	}
 
-	return nil
+	for _, period := range config.Rollups {
+		rollup := aggregate.SortedPoints(aggregate.Rollup(extracted, period, config, startDate, toDate))
+		measurement := fmt.Sprintf("%s_%s", config.InfluxMeasurement, period)
+
+		log.Printf("Writing %d %s Rollup Metrics to %s\n", len(rollup), period, measurement)
+		if err := WritePoints(c, config, measurement, rollup); err != nil {
+			return err
+		}
+	}
+
+	if err := exp.Commit(); err != nil {
+		return err
+	}
+
+	if recordCount > 0 {
+		percent := float64(unpricedCount) / float64(recordCount) * 100
+		log.Printf("Unpriced Records: %d of %d (%.2f%%)\n", unpricedCount, recordCount, percent)
+	}
+
+	// Past days would be forecast, alerted on and fed into the anomaly baselines as if they were new
+	if replay {
+		log.Println("Skipping Forecasts, Budgets and Anomalies for a Replay")
+		return nil
+	}
+
+	now := time.Now().In(toDate.Location())
+
+	if config.Forecast != nil {
+		log.Println("Forecasting Month-End Spend")
+		if err := WriteForecasts(c, config, "forecast", forecast.Project(extracted, config.Forecast, now)); err != nil {
+			return err
+		}
+	}
+
+	return analyse(c, config, extracted, now)
 }
 
-func CalculateCosts(records []*domain.UsageRecord, config *domain.Config, meters map[string]*domain.Meter) {
+// CalculateCosts - Prices records by the first matching pricing rule, falling back to the RateCard
+// rate multiplied by RateMultiply. Fixed rate rules also price meters missing from the RateCard.
+// Returns the records that could not be priced
+func CalculateCosts(records []*domain.UsageRecord, config *domain.Config, meters map[string]*domain.Meter) (unpriced []*domain.UsageRecord) {
 	for _, record := range records {
 		meter := meters[record.Properties.MeterID]
-		if meter == nil {
+		rule := pricing.Match(config.PricingRules, record)
+
+		switch {
+		case rule != nil && (meter != nil || rule.Rate != nil):
+			rate := decimal.Zero
+			if meter != nil {
+				rate = decimal.NewFromFloat(meter.MeterRates["0"])
+			}
+			record.Properties.MeterRate = pricing.Rate(rule, rate)
+			record.Properties.ListRate = rate
+			if meter == nil {
+				record.Properties.ListRate = record.Properties.MeterRate
+			}
+			record.Properties.PricingRule = rule.Name
+		case meter != nil:
+			rate := decimal.NewFromFloat(meter.MeterRates["0"])
+			record.Properties.MeterRate = rate.Mul(decimal.NewFromFloat(config.RateMultiply))
+			record.Properties.ListRate = rate
+			record.Properties.PricingRule = pricing.RateCardRule
+		default:
+			unpriced = append(unpriced, record)
 			continue
 		}
 
-		rate := meter.MeterRates["0"]
-		record.Properties.MeterRate = rate * config.RateMultiply
+		record.Properties.Cost = record.Properties.MeterRate.Mul(decimal.NewFromFloat(record.Properties.Quantity))
+		record.Properties.AmortisedCost = record.Properties.Cost
+	}
+
+	return unpriced
+}
+
+// WritePoints - Writes points to a measurement in a single batch
+func WritePoints(c client.Client, config *domain.Config, measurement string, points []*domain.Point) (err error) {
+	bp, err := newBatch(config)
+	if err != nil {
+		return err
+	}
+
+	rounder, err := money.NewRounder(config)
+	if err != nil {
+		return err
 	}
+
+	for _, point := range points {
+		if err := CreatePoint(bp, measurement, point, rounder); err != nil {
+			return err
+		}
+	}
+
+	return writeBatch(c, bp)
 }
 
-func CreatePoint(batchPoint client.BatchPoints, measurement string, point *domain.Point) (err error) {
+// WriteUnpriced - Writes the record count and quantity of each unpriced meter to a measurement
+func WriteUnpriced(c client.Client, config *domain.Config, measurement string, meters []*domain.UnpricedMeter) (err error) {
+	bp, err := newBatch(config)
+	if err != nil {
+		return err
+	}
+
+	for _, meter := range meters {
+		tags := map[string]string{
+			"SubscriptionID":   meter.SubscriptionID,
+			"Subscription":     meter.Subscription,
+			"MeterID":          meter.MeterID,
+			"MeterName":        meter.MeterName,
+			"MeterCategory":    meter.MeterCategory,
+			"MeterSubCategory": meter.MeterSubCategory,
+			"MeterRegion":      meter.MeterRegion,
+		}
+
+		fields := map[string]interface{}{
+			"Records":  meter.Records,
+			"Quantity": meter.Quantity,
+		}
+
+		pt, err := client.NewPoint(measurement, tags, fields, meter.Timestamp)
+		if err != nil {
+			return err
+		}
+
+		bp.AddPoint(pt)
+	}
+
+	return writeBatch(c, bp)
+}
+
+// WriteAnomalies - Writes anomalies with their baseline statistics to a measurement
+func WriteAnomalies(c client.Client, config *domain.Config, measurement string, anomalies []*domain.Anomaly) (err error) {
+	bp, err := newBatch(config)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range anomalies {
+		fields := map[string]interface{}{
+			"Cost":      a.Cost,
+			"Mean":      a.Mean,
+			"StdDev":    a.StdDev,
+			"ZScore":    a.ZScore,
+			"Deviation": a.Deviation,
+		}
+
+		pt, err := client.NewPoint(measurement, a.Tags, fields, a.Timestamp)
+		if err != nil {
+			return err
+		}
+
+		bp.AddPoint(pt)
+	}
+
+	return writeBatch(c, bp)
+}
+
+// WriteForecasts - Writes month-end forecasts with their confidence bounds to a measurement
+func WriteForecasts(c client.Client, config *domain.Config, measurement string, forecasts []*domain.Forecast) (err error) {
+	bp, err := newBatch(config)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range forecasts {
+		tags := map[string]string{
+			"Subscription": f.Subscription,
+			"Model":        f.Model,
+		}
+		if len(f.TagKey) > 0 {
+			tags[f.TagKey] = f.TagValue
+		}
+
+		fields := map[string]interface{}{
+			"MonthToDate": f.MonthToDate,
+			"Forecast":    f.Forecast,
+			"Lower":       f.Lower,
+			"Upper":       f.Upper,
+		}
+
+		pt, err := client.NewPoint(measurement, tags, fields, f.Timestamp)
+		if err != nil {
+			return err
+		}
+
+		bp.AddPoint(pt)
+	}
+
+	return writeBatch(c, bp)
+}
+
+func newBatch(config *domain.Config) (bp client.BatchPoints, err error) {
+	return client.NewBatchPoints(client.BatchPointsConfig{
+		Database:  config.InfluxDB,
+		Precision: "s",
+	})
+}
+
+func writeBatch(c client.Client, bp client.BatchPoints) (err error) {
+	if len(bp.Points()) == 0 {
+		return nil
+	}
+
+	return c.Write(bp)
+}
+
+func CreatePoint(batchPoint client.BatchPoints, measurement string, point *domain.Point, rounder money.Rounder) (err error) {
 	fields := map[string]interface{}{
-		"Quantity": point.Quantity,
-		"Cost":     point.Cost,
+		"Quantity":      point.Quantity,
+		"Cost":          rounder.Float(point.Cost),
+		"AmortisedCost": rounder.Float(point.AmortisedCost),
+	}
+	for field, value := range point.Converted {
+		fields[field] = rounder.Float(value)
+	}
+	for dimension, source := range point.TagSources {
+		fields[tags.SourceField(dimension)] = source
 	}
 
 	pt, err := client.NewPoint(measurement, point.Tags, fields, point.Timestamp)
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"path/filepath"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/aggregate"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/csv"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/focus"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/money"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/output"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/parquet"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/pricing"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/tags"
+)
+
+// exportFile - Buffered output file committed when the export completes
+type exportFile struct {
+	path   string
+	file   *output.File
+	writer *bufio.Writer
+}
+
+// exporter - Writes aggregated points and raw records to the configured file formats
+type exporter struct {
+	config        *domain.Config
+	columns       []string
+	rounder       money.Rounder
+	csvFile       *exportFile
+	focusFile     *exportFile
+	focusRawFile  *exportFile
+	unpricedFile  *exportFile
+	parquetWriter *parquet.Writer
+}
+
+func newExporter(config *domain.Config, fromDate, toDate time.Time) (e *exporter, err error) {
+	dir := output.Dir(config.OutputDir)
+	formats := output.Formats(config.OutputFormats)
+
+	dimensions := append(aggregate.Dimensions(config), tags.PassthroughDimensions(config.TagPassthrough, tags.NewNormaliser(config))...)
+
+	e = &exporter{
+		config:  config,
+		columns: csv.Columns(config.CSVColumns, dimensions),
+	}
+
+	if e.rounder, err = money.NewRounder(config); err != nil {
+		return nil, err
+	}
+
+	if formats["csv"] {
+		e.csvFile, err = createExportFile(filepath.Join(dir, output.FileName(config.Subscription, fromDate, toDate, "csv")))
+		if err != nil {
+			e.Close()
+			return nil, err
+		}
+
+		if err := csv.WriteHeaders(e.csvFile.writer, e.columns); err != nil {
+			e.Close()
+			return nil, err
+		}
+
+		e.unpricedFile, err = createExportFile(filepath.Join(dir, output.FileName(config.Subscription, fromDate, toDate, "unpriced.csv")))
+		if err != nil {
+			e.Close()
+			return nil, err
+		}
+
+		if err := pricing.WriteUnpricedHeaders(e.unpricedFile.writer); err != nil {
+			e.Close()
+			return nil, err
+		}
+	}
+
+	if formats["focus"] {
+		e.focusFile, err = createExportFile(filepath.Join(dir, output.FileName(config.Subscription, fromDate, toDate, "focus.csv")))
+		if err != nil {
+			e.Close()
+			return nil, err
+		}
+
+		if err := focus.WriteHeaders(e.focusFile.writer); err != nil {
+			e.Close()
+			return nil, err
+		}
+	}
+
+	if formats["focus-raw"] {
+		e.focusRawFile, err = createExportFile(filepath.Join(dir, output.FileName(config.Subscription, fromDate, toDate, "focus-raw.csv")))
+		if err != nil {
+			e.Close()
+			return nil, err
+		}
+
+		if err := focus.WriteHeaders(e.focusRawFile.writer); err != nil {
+			e.Close()
+			return nil, err
+		}
+	}
+
+	if formats["parquet"] {
+		e.parquetWriter = parquet.NewWriter(filepath.Join(dir, "parquet"), config.Subscription, e.rounder)
+	}
+
+	return e, nil
+}
+
+func createExportFile(path string) (ef *exportFile, err error) {
+	file, err := output.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &exportFile{
+		path:   path,
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}, nil
+}
+
+// Write - Appends a batch of records and their aggregated points to every configured format
+func (e *exporter) Write(records []*domain.UsageRecord, points []*domain.Point) (err error) {
+	if e.csvFile != nil {
+		if err := csv.WriteLines(e.csvFile.writer, e.columns, points, e.rounder); err != nil {
+			return err
+		}
+	}
+
+	if e.focusFile != nil {
+		rows := make([]*focus.Row, 0, len(points))
+		for _, point := range points {
+			rows = append(rows, focus.FromPoint(point, aggregate.Granularity(e.config)))
+		}
+
+		if err := focus.WriteRows(e.focusFile.writer, rows, e.rounder); err != nil {
+			return err
+		}
+	}
+
+	if e.focusRawFile != nil {
+		rows := make([]*focus.Row, 0, len(records))
+		for _, record := range records {
+			rows = append(rows, focus.FromRecord(record, e.config))
+		}
+
+		if err := focus.WriteRows(e.focusRawFile.writer, rows, e.rounder); err != nil {
+			return err
+		}
+	}
+
+	if e.parquetWriter != nil {
+		e.parquetWriter.Add(points)
+	}
+
+	return nil
+}
+
+// WriteUnpriced - Appends the unpriced meters of a day to the unpriced CSV
+func (e *exporter) WriteUnpriced(meters []*domain.UnpricedMeter) (err error) {
+	if e.unpricedFile == nil {
+		return nil
+	}
+
+	return pricing.WriteUnpriced(e.unpricedFile.writer, meters)
+}
+
+// Commit - Finalises the files of every configured format
+func (e *exporter) Commit() (err error) {
+	for _, ef := range []*exportFile{e.csvFile, e.focusFile, e.focusRawFile, e.unpricedFile} {
+		if ef == nil {
+			continue
+		}
+
+		log.Printf("Committing %s\n", ef.path)
+		if err := ef.file.Commit(); err != nil {
+			return err
+		}
+	}
+
+	if e.parquetWriter != nil {
+		paths, err := e.parquetWriter.Write()
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			log.Printf("Committed %s\n", path)
+		}
+	}
+
+	return nil
+}
+
+// Close - Discards any files that were not committed
+func (e *exporter) Close() {
+	for _, ef := range []*exportFile{e.csvFile, e.focusFile, e.focusRawFile, e.unpricedFile} {
+		if ef != nil {
+			ef.file.Close()
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/cloud"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/money"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/output"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/reconcile"
+)
+
+var invoicePath = flag.String("ri", "", "invoice CSV exported from the portal, defaults to the Cost Management API")
+
+// runReconcile - Compares the exported costs of a month with the invoiced cost per subscription and
+// meter category
+func runReconcile(config *domain.Config, loc *time.Location) (err error) {
+	month := time.Now().In(loc)
+	if len(*reportMonth) > 0 {
+		if month, err = time.ParseInLocation("2006-01", *reportMonth, loc); err != nil {
+			return err
+		}
+	}
+	startDate := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, loc)
+	endDate := startDate.AddDate(0, 1, 0)
+
+	rounder, err := money.NewRounder(config)
+	if err != nil {
+		return err
+	}
+
+	var lines []*domain.InvoiceLine
+	if len(*invoicePath) > 0 {
+		log.Printf("Reading Invoice %s\n", *invoicePath)
+		file, err := os.Open(*invoicePath)
+		if err != nil {
+			return err
+		}
+
+		lines, err = reconcile.ReadInvoice(file, startDate, endDate)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", *invoicePath, err)
+		}
+	} else {
+		log.Println("Creating Azure Client")
+		azureClient, err := cloud.NewAzureClient(config)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Retrieving Invoiced Costs for %s\n", startDate.Format("2006-01"))
+		if lines, err = azureClient.GetInvoiceLines(startDate, endDate); err != nil {
+			return err
+		}
+	}
+
+	points, err := loadExportedPoints(config, loc)
+	if err != nil {
+		return err
+	}
+
+	variances := reconcile.Compare(points, lines, startDate, endDate)
+	total := reconcile.Total(variances)
+	log.Printf("Computed %s, Invoiced %s, Variance %s (%+.2f%%)\n", rounder.Format(total.Computed), rounder.Format(total.Invoiced), rounder.Format(total.Difference), total.Percent)
+
+	var write func(f *output.File) error
+	switch *reportFormat {
+	case "md":
+		write = func(f *output.File) error {
+			return reconcile.WriteMarkdown(f, variances, config.Currency, startDate, rounder)
+		}
+	case "csv":
+		write = func(f *output.File) error { return reconcile.WriteCSV(f, variances, rounder) }
+	default:
+		return fmt.Errorf("unknown reconcile format: %s", *reportFormat)
+	}
+
+	path := filepath.Join(output.Dir(config.OutputDir), "reports", fmt.Sprintf("_%s_reconcile_%s.%s", config.Subscription, startDate.Format("2006-01"), *reportFormat))
+	file, err := output.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := write(file); err != nil {
+		return err
+	}
+
+	log.Printf("Writing Reconciliation %s\n", path)
+	return file.Commit()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/archive"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+// runReplay - Re-runs tagging, pricing and aggregation over archived usage records without calling Azure
+func runReplay(config *domain.Config, fromDate, toDate time.Time) (err error) {
+	if len(config.ArchiveDir) == 0 {
+		return errors.New("replay requires archiveDir in the configuration")
+	}
+
+	log.Printf("Loading Groups from %s\n", config.ArchiveDir)
+	groupMap, err := archive.ReadGroups(config.ArchiveDir, config.Subscription)
+	if err != nil {
+		return err
+	}
+
+	subscriptionTags, err := readSubscriptionTags(config)
+	if err != nil {
+		return err
+	}
+
+	c, err := connectInflux(config)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	src := &archiveSource{
+		dir:          config.ArchiveDir,
+		subscription: config.Subscription,
+	}
+
+	log.Printf("Replaying Azure Costs: %s\n", config.Subscription)
+	return ExtractData(src, groupMap, subscriptionTags, config, fromDate, toDate, c, true)
+}
+
+// readSubscriptionTags - Loads the archived subscription tags, archives written before subscription
+// tags were fetched have none
+func readSubscriptionTags(config *domain.Config) (subscriptionTags map[string]interface{}, err error) {
+	subscriptionTags, err = archive.ReadSubscriptionTags(config.ArchiveDir, config.Subscription)
+	if os.IsNotExist(err) {
+		log.Println("No archived Subscription Tags")
+		return nil, nil
+	}
+
+	return subscriptionTags, err
+}
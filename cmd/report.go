@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/aggregate"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/csv"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/money"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/output"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/report"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/tags"
+)
+
+var (
+	reportTag    = flag.String("rt", "", "report tag, e.g. CostCentre")
+	reportMonth  = flag.String("rm", "", "report month (YYYY-MM), defaults to the current month")
+	reportFormat = flag.String("rf", "md", "report format: md or html, md or csv for reconcile")
+)
+
+// runReport - Writes a monthly chargeback report per tag value from the exported CSV files
+func runReport(config *domain.Config, loc *time.Location) (err error) {
+	if len(*reportTag) == 0 {
+		return errors.New("report requires a tag (-rt)")
+	}
+	tagKey := fmt.Sprintf("_%s", strings.TrimPrefix(*reportTag, "_"))
+
+	month := time.Now().In(loc)
+	if len(*reportMonth) > 0 {
+		if month, err = time.ParseInLocation("2006-01", *reportMonth, loc); err != nil {
+			return err
+		}
+	}
+
+	var write func(w io.Writer, r *report.Report, rounder money.Rounder) error
+	switch *reportFormat {
+	case "md":
+		write = report.WriteMarkdown
+	case "html":
+		write = report.WriteHTML
+	default:
+		return fmt.Errorf("unknown report format: %s", *reportFormat)
+	}
+
+	rounder, err := money.NewRounder(config)
+	if err != nil {
+		return err
+	}
+
+	points, err := loadExportedPoints(config, loc)
+	if err != nil {
+		return err
+	}
+
+	if len(points) > 0 {
+		if _, ok := points[0].Tags[tagKey]; !ok {
+			return fmt.Errorf("exports have no %s column, add it to csvColumns or the dimensions", tagKey)
+		}
+	}
+
+	r := report.Build(points, tagKey, config.Currency, month)
+
+	path := filepath.Join(output.Dir(config.OutputDir), "reports", fmt.Sprintf("_%s_%s_%s.%s", config.Subscription, strings.TrimPrefix(tagKey, "_"), r.Month.Format("2006-01"), *reportFormat))
+	file, err := output.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := write(file, r, rounder); err != nil {
+		return err
+	}
+
+	log.Printf("Writing Report %s\n", path)
+	return file.Commit()
+}
+
+// loadExportedPoints - Reads the CSV exports of the subscription. Every day is taken whole from the
+// most recently written export covering it, so overlapping exports never add up. Rows sharing a key
+// within one export, such as hourly rows without an hour column, are summed
+func loadExportedPoints(config *domain.Config, loc *time.Location) (points []*domain.Point, err error) {
+	pattern := filepath.Join(output.Dir(config.OutputDir), fmt.Sprintf("_%s_????-??-??_????-??-??.csv", config.Subscription))
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	type export struct {
+		path     string
+		from     time.Time
+		to       time.Time
+		modified time.Time
+	}
+
+	var exports []*export
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), ".csv")
+		from, err := time.ParseInLocation("2006-01-02", name[len(name)-21:len(name)-11], loc)
+		if err != nil {
+			return nil, err
+		}
+
+		to, err := time.ParseInLocation("2006-01-02", name[len(name)-10:], loc)
+		if err != nil {
+			return nil, err
+		}
+
+		exports = append(exports, &export{path: path, from: from, to: to, modified: info.ModTime()})
+	}
+
+	sort.Slice(exports, func(i, j int) bool {
+		return exports[i].modified.After(exports[j].modified)
+	})
+
+	claimed := make(map[string]bool)
+	data := make(map[string]*domain.Point)
+	for _, exp := range exports {
+		days := make(map[string]bool)
+		for day := exp.from; day.Before(exp.to); day = day.AddDate(0, 0, 1) {
+			if date := day.Format("2006-01-02"); !claimed[date] {
+				days[date] = true
+			}
+		}
+
+		if len(days) == 0 {
+			log.Printf("Skipping %s, superseded by newer exports\n", exp.path)
+			continue
+		}
+
+		log.Printf("Reading %s\n", exp.path)
+
+		file, err := os.Open(exp.path)
+		if err != nil {
+			return nil, err
+		}
+
+		read, err := csv.ReadPoints(file, exp.from)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", exp.path, err)
+		}
+
+		for _, point := range read {
+			if !days[point.Timestamp.In(loc).Format("2006-01-02")] {
+				continue
+			}
+
+			key := fmt.Sprintf("%s/%s", aggregate.TagKey(point.Tags), point.Timestamp.Format(time.RFC3339))
+			if existing, found := data[key]; found {
+				existing.Quantity += point.Quantity
+				existing.Cost = existing.Cost.Add(point.Cost)
+				existing.AmortisedCost = existing.AmortisedCost.Add(point.AmortisedCost)
+				for field, value := range point.Converted {
+					existing.Converted[field] = existing.Converted[field].Add(value)
+				}
+				tags.MergeSources(existing.TagSources, point.TagSources)
+				continue
+			}
+
+			data[key] = point
+		}
+
+		for date := range days {
+			claimed[date] = true
+		}
+	}
+
+	return aggregate.SortedPoints(data), nil
+}
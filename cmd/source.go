@@ -0,0 +1,157 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/archive"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/cloud"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+// source - Supplies the rate card, daily usage records and reservation data for an extraction
+type source interface {
+	GetMeters() (meterMap map[string]*domain.Meter, err error)
+	GetReadings(startDate, endDate time.Time) (ur []*domain.UsageRecord, err error)
+	GetReservationTransactions(startDate, endDate time.Time) (transactions []*domain.ReservationTransaction, err error)
+	GetReservationDetails(startDate, endDate time.Time) (details []*domain.ReservationDetail, err error)
+}
+
+// meterSource - Supplies meters in place of the RateCard
+type meterSource interface {
+	GetMeters() (meterMap map[string]*domain.Meter, err error)
+}
+
+// pricedSource - Reads meters from a separate pricing source and everything else from the wrapped source
+type pricedSource struct {
+	source
+	meters meterSource
+}
+
+func (p *pricedSource) GetMeters() (meterMap map[string]*domain.Meter, err error) {
+	return p.meters.GetMeters()
+}
+
+// withPricing - Wraps the Azure source to read its meters from the configured pricing source
+func withPricing(config *domain.Config, azureClient *cloud.AzureClient) source {
+	if config.PricingSource != "retail" {
+		return azureClient
+	}
+
+	log.Println("Pricing from the Retail Prices API")
+	return &pricedSource{
+		source: azureClient,
+		meters: cloud.NewRetailPriceClient(config),
+	}
+}
+
+// archivingSource - Archives everything read from the wrapped source
+type archivingSource struct {
+	source
+	dir          string
+	subscription string
+}
+
+func (a *archivingSource) GetMeters() (meterMap map[string]*domain.Meter, err error) {
+	meterMap, err = a.source.GetMeters()
+	if err != nil || len(meterMap) == 0 {
+		return meterMap, err
+	}
+
+	log.Println("Archiving Meters")
+	if err := archive.WriteMeters(a.dir, a.subscription, meterMap); err != nil {
+		return nil, err
+	}
+
+	return meterMap, nil
+}
+
+func (a *archivingSource) GetReadings(startDate, endDate time.Time) (ur []*domain.UsageRecord, err error) {
+	ur, err = a.source.GetReadings(startDate, endDate)
+	if err != nil || len(ur) == 0 {
+		return ur, err
+	}
+
+	log.Printf("Archiving Readings for %s\n", startDate)
+	if err := archive.WriteReadings(a.dir, a.subscription, startDate, ur); err != nil {
+		return nil, err
+	}
+
+	return ur, nil
+}
+
+func (a *archivingSource) GetReservationTransactions(startDate, endDate time.Time) (transactions []*domain.ReservationTransaction, err error) {
+	transactions, err = a.source.GetReservationTransactions(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Archiving Reservation Transactions")
+	if err := archive.WriteReservationTransactions(a.dir, a.subscription, transactions); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+func (a *archivingSource) GetReservationDetails(startDate, endDate time.Time) (details []*domain.ReservationDetail, err error) {
+	details, err = a.source.GetReservationDetails(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Archiving Reservation Details for %s\n", startDate)
+	if err := archive.WriteReservationDetails(a.dir, a.subscription, startDate, details); err != nil {
+		return nil, err
+	}
+
+	return details, nil
+}
+
+// archiveSource - Reads the rate card and usage records from a local archive
+type archiveSource struct {
+	dir          string
+	subscription string
+}
+
+func (a *archiveSource) GetMeters() (meterMap map[string]*domain.Meter, err error) {
+	return archive.ReadMeters(a.dir, a.subscription)
+}
+
+func (a *archiveSource) GetReadings(startDate, endDate time.Time) (ur []*domain.UsageRecord, err error) {
+	ur, err = archive.ReadReadings(a.dir, a.subscription, startDate)
+	if os.IsNotExist(err) {
+		log.Printf("No archived Readings for %s\n", startDate)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cloud.PopulateInstanceData(ur); err != nil {
+		return nil, err
+	}
+
+	return ur, nil
+}
+
+func (a *archiveSource) GetReservationTransactions(startDate, endDate time.Time) (transactions []*domain.ReservationTransaction, err error) {
+	transactions, err = archive.ReadReservationTransactions(a.dir, a.subscription)
+	if os.IsNotExist(err) {
+		log.Println("No archived Reservation Transactions")
+		return nil, nil
+	}
+
+	return transactions, err
+}
+
+func (a *archiveSource) GetReservationDetails(startDate, endDate time.Time) (details []*domain.ReservationDetail, err error) {
+	details, err = archive.ReadReservationDetails(a.dir, a.subscription, startDate)
+	if os.IsNotExist(err) {
+		log.Printf("No archived Reservation Details for %s\n", startDate)
+		return nil, nil
+	}
+
+	return details, err
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/archive"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/cloud"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/money"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/output"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/tags"
+)
+
+var (
+	tagsFromArchive = flag.Bool("ta", false, "tags: read usage records from the archive instead of Azure")
+	auditFormat     = flag.String("tf", "csv", "tags audit format: csv or json")
+)
+
+// runTags - Runs a tags sub command
+func runTags(config *domain.Config, fromDate, toDate time.Time) (err error) {
+	switch command := flag.Arg(1); command {
+	case "test":
+		return runTagsTest(config, fromDate, toDate)
+	case "audit":
+		return runTagsAudit(config, fromDate)
+	default:
+		return fmt.Errorf("unknown tags command: %s", command)
+	}
+}
+
+// tagSource - Opens the archive or Azure as the source of usage records, resource groups and
+// subscription tags for the tags commands
+func tagSource(config *domain.Config) (src source, groupMap map[string]*domain.Group, subscriptionTags map[string]interface{}, err error) {
+	if *tagsFromArchive {
+		if len(config.ArchiveDir) == 0 {
+			return nil, nil, nil, fmt.Errorf("reading from the archive requires archiveDir in the configuration")
+		}
+
+		log.Printf("Loading Groups from %s\n", config.ArchiveDir)
+		groupMap, err = archive.ReadGroups(config.ArchiveDir, config.Subscription)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		subscriptionTags, err = readSubscriptionTags(config)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return &archiveSource{dir: config.ArchiveDir, subscription: config.Subscription}, groupMap, subscriptionTags, nil
+	}
+
+	log.Println("Creating Azure Client")
+	azureClient, err := cloud.NewAzureClient(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	log.Println("Loading Groups")
+	groupMap, err = azureClient.GetGroups()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	log.Println("Loading Subscription Tags")
+	subscriptionTags, err = azureClient.GetSubscriptionTags()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return withPricing(config, azureClient), groupMap, subscriptionTags, nil
+}
+
+// runTagsTest - Runs the tag rules over the usage records of the date range and lists which rule set
+// which tag on each resource, followed by the number of records each rule set a tag on
+func runTagsTest(config *domain.Config, fromDate, toDate time.Time) (err error) {
+	engine, err := tags.NewEngine(config)
+	if err != nil {
+		return err
+	}
+
+	src, groupMap, subscriptionTags, err := tagSource(config)
+	if err != nil {
+		return err
+	}
+
+	normaliser := tags.NewNormaliser(config)
+	tags.NormaliseGroups(groupMap, normaliser)
+	subscriptionTags = normaliser.Tags(subscriptionTags)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Resource\tTag\tValue\tPrevious\tRule")
+
+	counts := make(map[string]int)
+	seen := make(map[string]bool)
+	for day := fromDate; day.Before(toDate); day = day.AddDate(0, 0, 1) {
+		log.Printf("Retrieving Readings for %s\n", day)
+		usageRecords, err := src.GetReadings(day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+
+		tags.Normalise(usageRecords, normaliser)
+		tags.ApplyDefaults(usageRecords, groupMap, subscriptionTags, config)
+
+		for _, derivation := range engine.Apply(usageRecords) {
+			counts[derivation.Rule]++
+
+			resource := derivation.Record.Properties.InstanceData.Resources.ResourceURI
+			if len(resource) == 0 {
+				resource = derivation.Record.Properties.MeterCategory
+			}
+
+			line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", resource, derivation.Tag, derivation.Value, derivation.Previous, derivation.Rule)
+			if seen[line] {
+				continue
+			}
+			seen[line] = true
+
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Rule\tRecords")
+	for _, rule := range engine.Rules() {
+		fmt.Fprintf(w, "%s\t%d\n", rule, counts[rule])
+	}
+
+	return w.Flush()
+}
+
+// runTagsAudit - Reports the resource groups and resources lacking each TagDefaults key and the cost
+// that falls back to the defaults for the usage of a single day
+func runTagsAudit(config *domain.Config, day time.Time) (err error) {
+	var write func(w io.Writer, lines []*tags.AuditLine, rounder money.Rounder) error
+	switch *auditFormat {
+	case "csv":
+		write = tags.WriteAuditCSV
+	case "json":
+		write = tags.WriteAuditJSON
+	default:
+		return fmt.Errorf("unknown tags audit format: %s", *auditFormat)
+	}
+
+	rounder, err := money.NewRounder(config)
+	if err != nil {
+		return err
+	}
+
+	engine, err := tags.NewEngine(config)
+	if err != nil {
+		return err
+	}
+
+	src, groupMap, subscriptionTags, err := tagSource(config)
+	if err != nil {
+		return err
+	}
+
+	normaliser := tags.NewNormaliser(config)
+	tags.NormaliseGroups(groupMap, normaliser)
+	subscriptionTags = normaliser.Tags(subscriptionTags)
+
+	log.Println("Loading Meters")
+	meters, err := src.GetMeters()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Retrieving Readings for %s\n", day)
+	usageRecords, err := src.GetReadings(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+
+	tags.Normalise(usageRecords, normaliser)
+	tags.ApplyDefaults(usageRecords, groupMap, subscriptionTags, config)
+	engine.Apply(usageRecords)
+	CalculateCosts(usageRecords, config, meters)
+
+	lines := tags.Audit(usageRecords, groupMap, config)
+	log.Printf("Resource Groups lacking required tags: %d\n", len(lines))
+
+	path := filepath.Join(output.Dir(config.OutputDir), "reports", fmt.Sprintf("_%s_tags_audit_%s.%s", config.Subscription, day.Format("2006-01-02"), *auditFormat))
+	file, err := output.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := write(file, lines, rounder); err != nil {
+		return err
+	}
+
+	log.Printf("Writing Tags Audit %s\n", path)
+	return file.Commit()
+}
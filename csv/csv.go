@@ -2,63 +2,159 @@ package csv
 
 import (
 	"bufio"
+	gocsv "encoding/csv"
 	"fmt"
 	"strconv"
 	"strings"
 
 	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/fx"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/money"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/tags"
+
+	"github.com/shopspring/decimal"
 )
 
-func WriteHeaders(w *bufio.Writer) (err error) {
-	parts := []string{
-		"SubscriptionID",
-		"Subscription",
-		"MeterID",
-		"MeterCategory",
-		"MeterSubCategory",
-		"ResourceGroup",
-		"Resource",
-		"BillPeriod",
-		"Quantity",
-		"Cost",
-		"Month",
-		"Day",
+// DefaultColumns - Columns written when the configuration does not specify any, followed by the
+// tag dimensions
+var DefaultColumns = []string{
+	"SubscriptionID",
+	"Subscription",
+	"MeterID",
+	"MeterCategory",
+	"MeterSubCategory",
+	"ResourceGroup",
+	"Resource",
+	"BillPeriod",
+	"Quantity",
+	"Cost",
+	"Month",
+	"Day",
+}
+
+var columnValues = map[string]func(point *domain.Point) string{
+	"SubscriptionID":   func(point *domain.Point) string { return point.SubscriptionID },
+	"Subscription":     func(point *domain.Point) string { return point.Subscription },
+	"MeterID":          func(point *domain.Point) string { return point.MeterID },
+	"MeterCategory":    func(point *domain.Point) string { return point.MeterCategory },
+	"MeterSubCategory": func(point *domain.Point) string { return point.MeterSubCategory },
+	"MeterRegion":      func(point *domain.Point) string { return point.MeterRegion },
+	"Location":         func(point *domain.Point) string { return point.Location },
+	"ResourceGroup":    func(point *domain.Point) string { return point.ResourceGroup },
+	"Resource":         func(point *domain.Point) string { return point.Resource },
+	"BillPeriod":       func(point *domain.Point) string { return point.BillPeriod },
+	"Quantity":         func(point *domain.Point) string { return fmt.Sprintf("%f", point.Quantity) },
+	"PricingRule":      func(point *domain.Point) string { return point.PricingRule },
+	"Currency":         func(point *domain.Point) string { return point.Currency },
+	"Date":             func(point *domain.Point) string { return point.Timestamp.Format("2006-01-02") },
+	"Year":             func(point *domain.Point) string { return strconv.Itoa(point.Timestamp.Year()) },
+	"Month":            func(point *domain.Point) string { return strconv.Itoa(int(point.Timestamp.Month())) },
+	"Day":              func(point *domain.Point) string { return strconv.Itoa(point.Timestamp.Day()) },
+}
+
+var moneyValues = map[string]func(point *domain.Point) decimal.Decimal{
+	"Cost":          func(point *domain.Point) decimal.Decimal { return point.Cost },
+	"AmortisedCost": func(point *domain.Point) decimal.Decimal { return point.AmortisedCost },
+	"UnitPrice":     func(point *domain.Point) decimal.Decimal { return point.UnitPrice },
+}
+
+// Columns - Returns the configured columns, falling back to the defaults and the tag dimensions
+func Columns(columns []string, dimensions []string) []string {
+	if len(columns) > 0 {
+		return columns
 	}
 
-	line := strings.Join(parts, ",")
+	columns = append([]string{}, DefaultColumns...)
+	seen := make(map[string]bool)
+	for _, dimension := range dimensions {
+		if strings.HasPrefix(dimension, "_") && !seen[dimension] {
+			seen[dimension] = true
+			columns = append(columns, dimension)
+		}
+	}
 
-	if _, err := w.WriteString(fmt.Sprintf("%s\n", line)); err != nil {
-		return err
+	return columns
+}
+
+// ValidateColumns - Ensures every column is known, tag columns start with an underscore
+func ValidateColumns(columns []string) (err error) {
+	for _, column := range columns {
+		if strings.HasPrefix(column, "_") {
+			continue
+		}
+
+		if _, ok := moneyValues[column]; ok || fx.IsField(column) || tags.IsSourceField(column) {
+			continue
+		}
+
+		if _, ok := columnValues[column]; !ok {
+			return fmt.Errorf("unknown csv column: %s", column)
+		}
 	}
 
 	return nil
 }
 
-func WriteLines(w *bufio.Writer, points map[string]*domain.Point) (err error) {
+func WriteHeaders(w *bufio.Writer, columns []string) (err error) {
+	if err := ValidateColumns(columns); err != nil {
+		return err
+	}
+
+	cw := gocsv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// WriteLines - Writes a line per point, money columns are rounded by rounder
+func WriteLines(w *bufio.Writer, columns []string, points []*domain.Point, rounder money.Rounder) (err error) {
+	if err := ValidateColumns(columns); err != nil {
+		return err
+	}
+
+	cw := gocsv.NewWriter(w)
 	for _, point := range points {
-		parts := []string{
-			point.SubscriptionID,
-			point.Subscription,
-			point.MeterID,
-			point.MeterCategory,
-			point.MeterSubCategory,
-			point.ResourceGroup,
-			point.Resource,
-			point.BillPeriod,
-			fmt.Sprintf("%f", point.Quantity),
-			fmt.Sprintf("%f", point.Cost),
-			strconv.Itoa(int(point.Timestamp.Month())),
-			strconv.Itoa(point.Timestamp.Day()),
-		}
+		parts := make([]string, len(columns))
+		for i, column := range columns {
+			if strings.HasPrefix(column, "_") {
+				parts[i] = point.Tags[column]
+				continue
+			}
+
+			if value, ok := moneyValues[column]; ok {
+				parts[i] = rounder.Format(value(point))
+				continue
+			}
 
-		line := strings.Join(parts, ",")
+			if fx.IsField(column) {
+				parts[i] = rounder.Format(point.Converted[column])
+				continue
+			}
 
-		if _, err := w.WriteString(fmt.Sprintf("%s\n", line)); err != nil {
+			if tags.IsSourceField(column) {
+				parts[i] = point.TagSources[tags.SourceDimension(column)]
+				continue
+			}
+
+			parts[i] = columnValues[column](point)
+		}
+
+		if err := cw.Write(parts); err != nil {
 			return err
 		}
 	}
 
-	w.Flush()
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
 
-	return nil
+	return w.Flush()
 }
@@ -0,0 +1,154 @@
+package csv
+
+import (
+	gocsv "encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/fx"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/tags"
+
+	"github.com/shopspring/decimal"
+)
+
+var textColumns = map[string]func(point *domain.Point) *string{
+	"SubscriptionID":   func(point *domain.Point) *string { return &point.SubscriptionID },
+	"Subscription":     func(point *domain.Point) *string { return &point.Subscription },
+	"MeterID":          func(point *domain.Point) *string { return &point.MeterID },
+	"MeterCategory":    func(point *domain.Point) *string { return &point.MeterCategory },
+	"MeterSubCategory": func(point *domain.Point) *string { return &point.MeterSubCategory },
+	"MeterRegion":      func(point *domain.Point) *string { return &point.MeterRegion },
+	"Location":         func(point *domain.Point) *string { return &point.Location },
+	"ResourceGroup":    func(point *domain.Point) *string { return &point.ResourceGroup },
+	"Resource":         func(point *domain.Point) *string { return &point.Resource },
+	"BillPeriod":       func(point *domain.Point) *string { return &point.BillPeriod },
+	"Currency":         func(point *domain.Point) *string { return &point.Currency },
+	"PricingRule":      func(point *domain.Point) *string { return &point.PricingRule },
+}
+
+var numberColumns = map[string]func(point *domain.Point) *float64{
+	"Quantity": func(point *domain.Point) *float64 { return &point.Quantity },
+}
+
+var moneyColumns = map[string]func(point *domain.Point) *decimal.Decimal{
+	"Cost":          func(point *domain.Point) *decimal.Decimal { return &point.Cost },
+	"AmortisedCost": func(point *domain.Point) *decimal.Decimal { return &point.AmortisedCost },
+	"UnitPrice":     func(point *domain.Point) *decimal.Decimal { return &point.UnitPrice },
+}
+
+// ReadPoints - Reads points back from a file written by WriteHeaders and WriteLines. The timestamp
+// comes from the Date column, or from Year, Month and Day. Without a Year column the year of from
+// is used, moving to the next year for months before the month of from
+func ReadPoints(r io.Reader, from time.Time) (points []*domain.Point, err error) {
+	cr := gocsv.NewReader(r)
+
+	columns, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	for i, column := range columns {
+		index[column] = i
+	}
+
+	for {
+		parts, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		point := &domain.Point{
+			Tags:       make(map[string]string),
+			TagSources: make(map[string]string),
+			Converted:  make(map[string]decimal.Decimal),
+		}
+
+		for i, column := range columns {
+			if strings.HasPrefix(column, "_") {
+				point.Tags[column] = parts[i]
+				continue
+			}
+
+			if field, ok := textColumns[column]; ok {
+				*field(point) = parts[i]
+				point.Tags[column] = parts[i]
+				continue
+			}
+
+			if field, ok := numberColumns[column]; ok {
+				if *field(point), err = strconv.ParseFloat(parts[i], 64); err != nil {
+					return nil, fmt.Errorf("column %s: %v", column, err)
+				}
+				continue
+			}
+
+			if field, ok := moneyColumns[column]; ok {
+				if *field(point), err = decimal.NewFromString(parts[i]); err != nil {
+					return nil, fmt.Errorf("column %s: %v", column, err)
+				}
+				continue
+			}
+
+			if fx.IsField(column) {
+				if point.Converted[column], err = decimal.NewFromString(parts[i]); err != nil {
+					return nil, fmt.Errorf("column %s: %v", column, err)
+				}
+				continue
+			}
+
+			if tags.IsSourceField(column) {
+				point.TagSources[tags.SourceDimension(column)] = parts[i]
+			}
+		}
+
+		point.Timestamp, err = timestamp(parts, index, from)
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+func timestamp(parts []string, index map[string]int, from time.Time) (t time.Time, err error) {
+	if i, ok := index["Date"]; ok {
+		return time.ParseInLocation("2006-01-02", parts[i], from.Location())
+	}
+
+	mi, monthOK := index["Month"]
+	di, dayOK := index["Day"]
+	if !monthOK || !dayOK {
+		return t, fmt.Errorf("csv requires a Date column or Month and Day columns")
+	}
+
+	month, err := strconv.Atoi(parts[mi])
+	if err != nil {
+		return t, err
+	}
+
+	day, err := strconv.Atoi(parts[di])
+	if err != nil {
+		return t, err
+	}
+
+	year := from.Year()
+	if yi, ok := index["Year"]; ok {
+		if year, err = strconv.Atoi(parts[yi]); err != nil {
+			return t, err
+		}
+	} else if time.Month(month) < from.Month() {
+		year++
+	}
+
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, from.Location()), nil
+}
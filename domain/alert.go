@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// Alert - Notification raised by the analysis stages, ID identifies the alert for de-duplication
+type Alert struct {
+	ID        string                 `json:"id"`
+	Kind      string                 `json:"kind"`
+	Subject   string                 `json:"subject"`
+	Message   string                 `json:"message"`
+	Timestamp time.Time              `json:"timestamp"`
+	Details   map[string]interface{} `json:"details"`
+}
+
+// NotifierConfig - Destination for alerts: webhook (URL, Headers), smtp (Host, Port, Username,
+// Password, From, To) or file (Path)
+type NotifierConfig struct {
+	Type     string            `json:"type"`
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers"`
+	Host     string            `json:"host"`
+	Port     int               `json:"port"`
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+	From     string            `json:"from"`
+	To       []string          `json:"to"`
+	Path     string            `json:"path"`
+}
@@ -0,0 +1,11 @@
+package domain
+
+// AllocationRule - Splits the cost of a shared resource group across the values of a tag, either by
+// fixed shares or proportionally to the spend each value has outside the shared resource group
+type AllocationRule struct {
+	Name          string             `json:"name"`
+	ResourceGroup string             `json:"resourceGroup"`
+	TagKey        string             `json:"tagKey"`
+	Method        string             `json:"method"`
+	Shares        map[string]float64 `json:"shares"`
+}
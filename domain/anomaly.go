@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+// AnomalyConfig - Rolling baseline settings for cost anomaly detection. Dimensions defaults to
+// ResourceGroup, Resource and MeterID; a day is flagged when it exceeds either ZScore or Percent
+type AnomalyConfig struct {
+	Dimensions []string `json:"dimensions"`
+	Window     int      `json:"window"`
+	MinHistory int      `json:"minHistory"`
+	ZScore     float64  `json:"zScore"`
+	Percent    float64  `json:"percent"`
+	MinCost    float64  `json:"minCost"`
+}
+
+// DailyCost - Cost of a single day in a baseline history
+type DailyCost struct {
+	Date string  `json:"date"`
+	Cost float64 `json:"cost"`
+}
+
+// Anomaly - Day on which the cost of a key deviated from its rolling baseline
+type Anomaly struct {
+	Key       string
+	Tags      map[string]string
+	Timestamp time.Time
+	Cost      float64
+	Mean      float64
+	StdDev    float64
+	ZScore    float64
+	Deviation float64
+}
@@ -0,0 +1,13 @@
+package domain
+
+// Budget - Monthly spend limit for a subscription, resource group or tag value, with the
+// percentages of the amount at which alerts are raised
+type Budget struct {
+	Name          string    `json:"name"`
+	Subscription  string    `json:"subscription"`
+	ResourceGroup string    `json:"resourceGroup"`
+	TagKey        string    `json:"tagKey"`
+	TagValue      string    `json:"tagValue"`
+	Amount        float64   `json:"amount"`
+	Thresholds    []float64 `json:"thresholds"`
+}
@@ -1,21 +1,69 @@
 package domain
 
+import "time"
+
 // Config - Application utilisation parameters
 type Config struct {
-	TenantID          string            `json:"tenantId"`
-	Subscription      string            `json:"subscription"`
-	SubscriptionID    string            `json:"subscriptionId"`
-	ClientID          string            `json:"clientId"`
-	ClientSecret      string            `json:"clientSecret"`
-	OfferDurableID    string            `json:"offerDurableId"`
-	Currency          string            `json:"currency"`
-	Locale            string            `json:"locale"`
-	RegionInfo        string            `json:"regionInfo"`
-	TimeOffset        int               `json:"timeOffset"`
-	InfluxHost        string            `json:"influxHost"`
-	InfluxDB          string            `json:"influxDB"`
-	InfluxMeasurement string            `json:"influxMeasurement"`
-	RateMultiply      float64           `json:"rateMultiply"`
-	TagDefaults       map[string]string `json:"tagDefaults"`
-	MissingDefault    string            `json:"missingDefault"`
+	TenantID            string            `json:"tenantId"`
+	Subscription        string            `json:"subscription"`
+	SubscriptionID      string            `json:"subscriptionId"`
+	BillingAccountID    string            `json:"billingAccountId"`
+	ClientID            string            `json:"clientId"`
+	ClientSecret        string            `json:"clientSecret"`
+	OfferDurableID      string            `json:"offerDurableId"`
+	Currency            string            `json:"currency"`
+	ReportingCurrencies []string          `json:"reportingCurrencies"`
+	FX                  *FXConfig         `json:"fx"`
+	Locale              string            `json:"locale"`
+	RegionInfo          string            `json:"regionInfo"`
+	TimeZone            string            `json:"timeZone"`
+	TimeOffset          int               `json:"timeOffset"` // whole hours east of UTC, formerly added to timestamps as a raw duration
+	InfluxHost          string            `json:"influxHost"`
+	InfluxDB            string            `json:"influxDB"`
+	InfluxMeasurement   string            `json:"influxMeasurement"`
+	RateMultiply        float64           `json:"rateMultiply"`
+	CostDecimals        *int32            `json:"costDecimals"`
+	RoundingMode        string            `json:"roundingMode"`
+	Amortisation        bool              `json:"amortisation"`
+	PricingFile         string            `json:"pricingFile"`
+	PricingRules        []*PricingRule    `json:"pricingRules"`
+	PricingSource       string            `json:"pricingSource"`
+	RetailPricesURL     string            `json:"retailPricesUrl"`
+	RetailPricesFilter  string            `json:"retailPricesFilter"`
+	PriceCacheHours     int               `json:"priceCacheHours"`
+	MaxUnpricedPercent  float64           `json:"maxUnpricedPercent"`
+	TagNormalisation    *TagNormalisation `json:"tagNormalisation"`
+	TagDefaults         map[string]string `json:"tagDefaults"`
+	MissingDefault      string            `json:"missingDefault"`
+	TagPrecedence       []string          `json:"tagPrecedence"`
+	TagRules            []*TagRule        `json:"tagRules"`
+	TagPassthrough      *TagPassthrough   `json:"tagPassthrough"`
+	CSVColumns          []string          `json:"csvColumns"`
+	OutputDir           string            `json:"outputDir"`
+	OutputFormats       []string          `json:"outputFormats"`
+	ArchiveDir          string            `json:"archiveDir"`
+	Dimensions          []string          `json:"dimensions"`
+	Granularity         string            `json:"granularity"`
+	Rollups             []string          `json:"rollups"`
+	BillPeriodDay       int               `json:"billPeriodDay"`
+	AllocationRules     []*AllocationRule `json:"allocationRules"`
+	Budgets             []*Budget         `json:"budgets"`
+	Notifiers           []*NotifierConfig `json:"notifiers"`
+	StateDir            string            `json:"stateDir"`
+	Anomaly             *AnomalyConfig    `json:"anomaly"`
+	Forecast            *ForecastConfig   `json:"forecast"`
+}
+
+// Location - Time zone that daily buckets and date arguments align to. TimeZone takes an IANA
+// name, TimeOffset is a fixed offset in hours kept for older configurations
+func (c *Config) Location() (loc *time.Location, err error) {
+	if len(c.TimeZone) > 0 {
+		return time.LoadLocation(c.TimeZone)
+	}
+
+	if c.TimeOffset != 0 {
+		return time.FixedZone("", c.TimeOffset*60*60), nil
+	}
+
+	return time.UTC, nil
 }
@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// ForecastConfig - Month-end forecast settings. TagKey adds a series per tag value next to the
+// subscription series and History is the number of complete days the models are fitted on
+type ForecastConfig struct {
+	TagKey  string `json:"tagKey"`
+	History int    `json:"history"`
+}
+
+// Forecast - Projected end-of-month spend of a series with its confidence bounds
+type Forecast struct {
+	Subscription string
+	TagKey       string
+	TagValue     string
+	Model        string
+	Timestamp    time.Time
+	MonthToDate  float64
+	Forecast     float64
+	Lower        float64
+	Upper        float64
+}
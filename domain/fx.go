@@ -0,0 +1,19 @@
+package domain
+
+// FXConfig - Source of the dated exchange rate table: file (Path to a CSV or JSON table) or http
+// (URL serving a JSON table, with optional Headers)
+type FXConfig struct {
+	Type    string            `json:"type"`
+	Path    string            `json:"path"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+// FXRate - Converts one unit of From into To, effective from Date (YYYY-MM-DD) until the next rate
+// of the same pair
+type FXRate struct {
+	Date string  `json:"date"`
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Rate float64 `json:"rate"`
+}
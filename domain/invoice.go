@@ -0,0 +1,11 @@
+package domain
+
+import "github.com/shopspring/decimal"
+
+// InvoiceLine - Invoiced cost of a meter category in a subscription for a billing period
+type InvoiceLine struct {
+	SubscriptionID string
+	Subscription   string
+	MeterCategory  string
+	Cost           decimal.Decimal
+}
@@ -1,6 +1,10 @@
 package domain
 
-import "time"
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 type Point struct {
 	SubscriptionID   string
@@ -8,11 +12,22 @@ type Point struct {
 	MeterID          string
 	MeterCategory    string
 	MeterSubCategory string
+	MeterRegion      string
+	Location         string
 	ResourceGroup    string
 	Resource         string
+	ResourceID       string
 	BillPeriod       string
 	Quantity         float64
-	Cost             float64
+	Unit             string
+	Cost             decimal.Decimal
+	AmortisedCost    decimal.Decimal
+	UnitPrice        decimal.Decimal
+	ListUnitPrice    decimal.Decimal
+	PricingRule      string
+	Currency         string
+	Converted        map[string]decimal.Decimal
 	Tags             map[string]string
+	TagSources       map[string]string
 	Timestamp        time.Time
 }
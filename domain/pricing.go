@@ -0,0 +1,14 @@
+package domain
+
+// PricingRule - Overrides the RateCard price of the meters it matches with a fixed negotiated rate or
+// a multiplier on the RateCard rate. MeterID matches exactly, the category, sub-category and region are
+// case-insensitive patterns where an empty pattern matches any value
+type PricingRule struct {
+	Name             string   `json:"name"`
+	MeterID          string   `json:"meterId"`
+	MeterCategory    string   `json:"meterCategory"`
+	MeterSubCategory string   `json:"meterSubCategory"`
+	MeterRegion      string   `json:"meterRegion"`
+	Rate             *float64 `json:"rate"`
+	Multiply         float64  `json:"multiply"`
+}
@@ -0,0 +1,34 @@
+package domain
+
+import "time"
+
+// ReservationTransaction - Purchase, refund or exchange of a reservation order
+type ReservationTransaction struct {
+	EventDate                  time.Time `json:"eventDate"`
+	EventType                  string    `json:"eventType"`
+	ReservationOrderID         string    `json:"reservationOrderId"`
+	ReservationOrderName       string    `json:"reservationOrderName"`
+	Description                string    `json:"description"`
+	Quantity                   float64   `json:"quantity"`
+	Amount                     float64   `json:"amount"`
+	Currency                   string    `json:"currency"`
+	ArmSkuName                 string    `json:"armSkuName"`
+	Term                       string    `json:"term"`
+	Region                     string    `json:"region"`
+	BillingFrequency           string    `json:"billingFrequency"`
+	PurchasingSubscriptionGUID string    `json:"purchasingSubscriptionGuid"`
+	PurchasingSubscriptionName string    `json:"purchasingSubscriptionName"`
+}
+
+// ReservationDetail - Hours of a reservation used by a single instance on a day
+type ReservationDetail struct {
+	ReservationOrderID    string    `json:"reservationOrderId"`
+	ReservationID         string    `json:"reservationId"`
+	SkuName               string    `json:"skuName"`
+	ReservedHours         float64   `json:"reservedHours"`
+	UsageDate             time.Time `json:"usageDate"`
+	UsedHours             float64   `json:"usedHours"`
+	InstanceID            string    `json:"instanceId"`
+	TotalReservedQuantity float64   `json:"totalReservedQuantity"`
+	Kind                  string    `json:"kind"`
+}
@@ -0,0 +1,12 @@
+package domain
+
+// TagNormalisation - Canonical forms of tag keys and values. KeyAliases map alternative keys to a
+// canonical key, ValueAliases map alternative values to a canonical value per canonical key, with "*"
+// applying to every key. Keys and values are trimmed and matched case-insensitively. FoldUnknown also
+// folds keys and values without a canonical form onto the first spelling seen, otherwise they are only
+// trimmed
+type TagNormalisation struct {
+	KeyAliases   map[string]string            `json:"keyAliases"`
+	ValueAliases map[string]map[string]string `json:"valueAliases"`
+	FoldUnknown  bool                         `json:"foldUnknown"`
+}
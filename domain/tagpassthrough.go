@@ -0,0 +1,11 @@
+package domain
+
+// TagPassthrough - Resource tags copied onto points as tag dimensions in addition to the configured
+// ones. All copies every tag, otherwise only the tags in Allow are copied. Tags in Deny are never copied.
+// Allow and Deny match keys regardless of case. The default CSV columns include the Allow tags but not
+// the tags only copied by All, list those in CSVColumns to tell apart points that differ only in them
+type TagPassthrough struct {
+	All   bool     `json:"all"`
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
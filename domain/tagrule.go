@@ -0,0 +1,15 @@
+package domain
+
+// TagRule - Derives the value of Tag from a field of a usage record. Field is a record field such as
+// ResourceGroup, Subscription or MeterCategory, or an underscore prefixed tag. When Pattern, a regular
+// expression, matches the field the tag is set to Value, in which $1 or ${name} refer to the submatches.
+// A rule fills tags that are missing, empty or still hold their default, and replaces values set by
+// the resource or earlier rules only when Overwrite is set
+type TagRule struct {
+	Name      string `json:"name"`
+	Tag       string `json:"tag"`
+	Field     string `json:"field"`
+	Pattern   string `json:"pattern"`
+	Value     string `json:"value"`
+	Overwrite bool   `json:"overwrite"`
+}
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// UnpricedMeter - Usage of a meter that no pricing rule or rate card entry priced on a day
+type UnpricedMeter struct {
+	SubscriptionID   string
+	Subscription     string
+	MeterID          string
+	MeterName        string
+	MeterCategory    string
+	MeterSubCategory string
+	MeterRegion      string
+	Unit             string
+	Records          int
+	Quantity         float64
+	Timestamp        time.Time
+}
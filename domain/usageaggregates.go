@@ -1,6 +1,10 @@
 package domain
 
-import "time"
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 // InstanceData - Contains all the additional data of the entry
 type InstanceData struct {
@@ -20,21 +24,26 @@ type InstanceData struct {
 
 // Properties - Contains details for each usage record
 type Properties struct {
-	SubscriptionID   string        `json:"subscriptionId"`
-	UsageStartTime   time.Time     `json:"usageStartTime"`
-	UsageEndTime     time.Time     `json:"usageEndTime"`
-	MeterName        string        `json:"meterName"`
-	MeterRegion      string        `json:"meterRegion"`
-	MeterCategory    string        `json:"meterCategory"`
-	MeterSubCategory string        `json:"meterSubCategory"`
-	MeterRate        float64       `json:"meterRate"`
-	Unit             string        `json:"unit"`
-	InstanceDataText string        `json:"instanceData"`
-	InstanceData     *InstanceData `json:"-"`
-	ResourceGroup    string        `json:"-"`
-	Resource         string        `json:"-"`
-	MeterID          string        `json:"meterId"`
-	Quantity         float64       `json:"quantity"`
+	SubscriptionID   string            `json:"subscriptionId"`
+	UsageStartTime   time.Time         `json:"usageStartTime"`
+	UsageEndTime     time.Time         `json:"usageEndTime"`
+	MeterName        string            `json:"meterName"`
+	MeterRegion      string            `json:"meterRegion"`
+	MeterCategory    string            `json:"meterCategory"`
+	MeterSubCategory string            `json:"meterSubCategory"`
+	MeterRate        decimal.Decimal   `json:"meterRate"`
+	ListRate         decimal.Decimal   `json:"-"`
+	PricingRule      string            `json:"-"`
+	Cost             decimal.Decimal   `json:"-"`
+	AmortisedCost    decimal.Decimal   `json:"-"`
+	Unit             string            `json:"unit"`
+	InstanceDataText string            `json:"instanceData"`
+	InstanceData     *InstanceData     `json:"-"`
+	TagSources       map[string]string `json:"-"`
+	ResourceGroup    string            `json:"-"`
+	Resource         string            `json:"-"`
+	MeterID          string            `json:"meterId"`
+	Quantity         float64           `json:"quantity"`
 }
 
 // UsageRecords - Contains the individual records data
@@ -0,0 +1,339 @@
+package focus
+
+import (
+	"bufio"
+	gocsv "encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/aggregate"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/amortise"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/money"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/tags"
+
+	"github.com/shopspring/decimal"
+)
+
+// Columns - FinOps FOCUS columns in the order they are written
+var Columns = []string{
+	"BilledCost",
+	"BillingCurrency",
+	"BillingPeriodStart",
+	"BillingPeriodEnd",
+	"ChargeCategory",
+	"ChargeDescription",
+	"ChargeFrequency",
+	"ChargePeriodStart",
+	"ChargePeriodEnd",
+	"ConsumedQuantity",
+	"ConsumedUnit",
+	"ContractedCost",
+	"EffectiveCost",
+	"InvoiceIssuerName",
+	"ListCost",
+	"ListUnitPrice",
+	"PricingQuantity",
+	"PricingUnit",
+	"ProviderName",
+	"PublisherName",
+	"RegionId",
+	"RegionName",
+	"ResourceId",
+	"ResourceName",
+	"ResourceType",
+	"ServiceCategory",
+	"ServiceName",
+	"SkuId",
+	"SubAccountId",
+	"SubAccountName",
+	"Tags",
+	"x_BillPeriod",
+	"x_MeterSubCategory",
+}
+
+// Row - A single FOCUS charge row
+type Row struct {
+	BilledCost         decimal.Decimal
+	BillingCurrency    string
+	BillingPeriodStart time.Time
+	BillingPeriodEnd   time.Time
+	ChargeCategory     string
+	ChargeDescription  string
+	ChargeFrequency    string
+	ChargePeriodStart  time.Time
+	ChargePeriodEnd    time.Time
+	ConsumedQuantity   float64
+	ConsumedUnit       string
+	ContractedCost     decimal.Decimal
+	EffectiveCost      decimal.Decimal
+	ListCost           decimal.Decimal
+	ListUnitPrice      decimal.Decimal
+	RegionName         string
+	ResourceID         string
+	ResourceName       string
+	ServiceName        string
+	SkuID              string
+	SubAccountID       string
+	SubAccountName     string
+	Tags               map[string]string
+	BillPeriod         string
+	MeterSubCategory   string
+}
+
+var serviceCategories = map[string]string{
+	"Virtual Machines":              "Compute",
+	"Virtual Machines Licenses":     "Compute",
+	"Azure App Service":             "Compute",
+	"Functions":                     "Compute",
+	"Container Instances":           "Compute",
+	"Azure Kubernetes Service":      "Compute",
+	"Cloud Services":                "Compute",
+	"Storage":                       "Storage",
+	"Backup":                        "Storage",
+	"Bandwidth":                     "Networking",
+	"Networking":                    "Networking",
+	"Virtual Network":               "Networking",
+	"Load Balancer":                 "Networking",
+	"VPN Gateway":                   "Networking",
+	"Application Gateway":           "Networking",
+	"Azure DNS":                     "Networking",
+	"Content Delivery Network":      "Networking",
+	"ExpressRoute":                  "Networking",
+	"SQL Database":                  "Databases",
+	"SQL Managed Instance":          "Databases",
+	"Azure Cosmos DB":               "Databases",
+	"Redis Cache":                   "Databases",
+	"Azure Monitor":                 "Management and Governance",
+	"Log Analytics":                 "Management and Governance",
+	"Insight and Analytics":         "Management and Governance",
+	"Automation":                    "Management and Governance",
+	"Key Vault":                     "Security",
+	"Security Center":               "Security",
+	"Azure Active Directory":        "Identity",
+	"Service Bus":                   "Integration",
+	"Event Hubs":                    "Integration",
+	"Logic Apps":                    "Integration",
+	"API Management":                "Integration",
+	"Cognitive Services":            "AI and Machine Learning",
+	"Machine Learning Studio":       "AI and Machine Learning",
+	"Azure Machine Learning":        "AI and Machine Learning",
+	"Azure Data Factory v2":         "Analytics",
+	"HDInsight":                     "Analytics",
+	"Azure Synapse Analytics":       "Analytics",
+	"Azure Database for MySQL":      "Databases",
+	"Azure Database for PostgreSQL": "Databases",
+}
+
+// ServiceCategory - Maps an Azure meter category onto a FOCUS service category
+func ServiceCategory(meterCategory string) string {
+	if category, ok := serviceCategories[meterCategory]; ok {
+		return category
+	}
+
+	if strings.HasPrefix(meterCategory, "Azure Database for") {
+		return "Databases"
+	}
+
+	return "Other"
+}
+
+// charge - FOCUS charge category and frequency, reservation purchases are one-time purchases
+func charge(meterCategory, meterSubCategory string) (category, frequency string) {
+	if meterCategory == amortise.ReservationCategory && meterSubCategory == amortise.PurchaseSubCategory {
+		return "Purchase", "One-Time"
+	}
+
+	return "Usage", "Usage-Based"
+}
+
+// priced - Cost of quantity at rate, falling back to cost for purchases and unknown rates
+func priced(rate decimal.Decimal, quantity float64, cost decimal.Decimal, category string) decimal.Decimal {
+	if category == "Purchase" || rate.IsZero() {
+		return cost
+	}
+
+	return rate.Mul(decimal.NewFromFloat(quantity))
+}
+
+// FromPoint - Maps an aggregated point of the granularity onto a FOCUS row. List and contracted costs
+// are priced from the unit prices, which are only known when MeterID is a dimension
+func FromPoint(point *domain.Point, granularity string) (row *Row) {
+	tags := make(map[string]string)
+	for key, value := range point.Tags {
+		if strings.HasPrefix(key, "_") {
+			tags[strings.TrimPrefix(key, "_")] = value
+		}
+	}
+
+	category, frequency := charge(point.MeterCategory, point.MeterSubCategory)
+
+	return &Row{
+		BilledCost:        point.Cost,
+		BillingCurrency:   point.Currency,
+		ChargeCategory:    category,
+		ChargeDescription: point.MeterSubCategory,
+		ChargeFrequency:   frequency,
+		ChargePeriodStart: point.Timestamp,
+		ChargePeriodEnd:   aggregate.BucketEnd(point.Timestamp, granularity),
+		ConsumedQuantity:  point.Quantity,
+		ConsumedUnit:      point.Unit,
+		ContractedCost:    priced(point.UnitPrice, point.Quantity, point.Cost, category),
+		EffectiveCost:     point.AmortisedCost,
+		ListCost:          priced(point.ListUnitPrice, point.Quantity, point.Cost, category),
+		ListUnitPrice:     point.ListUnitPrice,
+		RegionName:        point.Location,
+		ResourceID:        point.ResourceID,
+		ResourceName:      point.Resource,
+		ServiceName:       point.MeterCategory,
+		SkuID:             point.MeterID,
+		SubAccountID:      point.SubscriptionID,
+		SubAccountName:    point.Subscription,
+		Tags:              tags,
+		BillPeriod:        point.BillPeriod,
+		MeterSubCategory:  point.MeterSubCategory,
+	}
+}
+
+// FromRecord - Maps a raw usage record onto a FOCUS row
+func FromRecord(record *domain.UsageRecord, config *domain.Config) (row *Row) {
+	category, frequency := charge(record.Properties.MeterCategory, record.Properties.MeterSubCategory)
+
+	row = &Row{
+		BilledCost:        record.Properties.Cost,
+		BillingCurrency:   config.Currency,
+		ChargeCategory:    category,
+		ChargeDescription: record.Properties.MeterName,
+		ChargeFrequency:   frequency,
+		ChargePeriodStart: record.Properties.UsageStartTime,
+		ChargePeriodEnd:   record.Properties.UsageEndTime,
+		ConsumedQuantity:  record.Properties.Quantity,
+		ConsumedUnit:      record.Properties.Unit,
+		ListUnitPrice:     record.Properties.ListRate,
+		RegionName:        record.Properties.MeterRegion,
+		ResourceName:      record.Properties.Resource,
+		ServiceName:       record.Properties.MeterCategory,
+		SkuID:             record.Properties.MeterID,
+		SubAccountID:      record.Properties.SubscriptionID,
+		SubAccountName:    config.Subscription,
+		Tags:              make(map[string]string),
+		BillPeriod:        record.Name,
+		MeterSubCategory:  record.Properties.MeterSubCategory,
+	}
+	row.ContractedCost = priced(record.Properties.MeterRate, record.Properties.Quantity, record.Properties.Cost, category)
+	row.EffectiveCost = record.Properties.AmortisedCost
+	row.ListCost = priced(record.Properties.ListRate, record.Properties.Quantity, record.Properties.Cost, category)
+
+	if record.Properties.InstanceData != nil {
+		if len(record.Properties.InstanceData.Resources.ResourceURI) > 0 {
+			row.ResourceID = fmt.Sprintf("/%s", record.Properties.InstanceData.Resources.ResourceURI)
+		}
+		row.RegionName = record.Properties.InstanceData.Resources.Location
+
+		for key, value := range record.Properties.InstanceData.Resources.Tags {
+			row.Tags[key] = tags.String(value)
+		}
+	}
+
+	return row
+}
+
+// ResourceType - Extracts the provider namespace and type from an Azure resource ID
+func ResourceType(resourceID string) string {
+	parts := strings.Split(strings.Trim(resourceID, "/"), "/")
+	for i, part := range parts {
+		if strings.EqualFold(part, "providers") && i+2 < len(parts) {
+			return fmt.Sprintf("%s/%s", parts[i+1], parts[i+2])
+		}
+	}
+
+	return ""
+}
+
+func WriteHeaders(w *bufio.Writer) (err error) {
+	cw := gocsv.NewWriter(w)
+	if err := cw.Write(Columns); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// WriteRows - Writes the rows, costs and prices are rounded by rounder
+func WriteRows(w *bufio.Writer, rows []*Row, rounder money.Rounder) (err error) {
+	cw := gocsv.NewWriter(w)
+	for _, row := range rows {
+		parts, err := row.values(rounder)
+		if err != nil {
+			return err
+		}
+
+		if err := cw.Write(parts); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func (r *Row) values(rounder money.Rounder) (parts []string, err error) {
+	tags, err := json.Marshal(r.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	billingStart := r.BillingPeriodStart
+	billingEnd := r.BillingPeriodEnd
+	if billingStart.IsZero() {
+		billingStart = time.Date(r.ChargePeriodStart.Year(), r.ChargePeriodStart.Month(), 1, 0, 0, 0, 0, r.ChargePeriodStart.Location())
+		billingEnd = billingStart.AddDate(0, 1, 0)
+	}
+
+	return []string{
+		rounder.Format(r.BilledCost),
+		r.BillingCurrency,
+		billingStart.Format(time.RFC3339),
+		billingEnd.Format(time.RFC3339),
+		r.ChargeCategory,
+		r.ChargeDescription,
+		r.ChargeFrequency,
+		r.ChargePeriodStart.Format(time.RFC3339),
+		r.ChargePeriodEnd.Format(time.RFC3339),
+		fmt.Sprintf("%f", r.ConsumedQuantity),
+		r.ConsumedUnit,
+		rounder.Format(r.ContractedCost),
+		rounder.Format(r.EffectiveCost),
+		"Microsoft",
+		rounder.Format(r.ListCost),
+		rounder.Format(r.ListUnitPrice),
+		fmt.Sprintf("%f", r.ConsumedQuantity),
+		r.ConsumedUnit,
+		"Microsoft",
+		"Microsoft",
+		strings.ToLower(strings.Replace(r.RegionName, " ", "", -1)),
+		r.RegionName,
+		r.ResourceID,
+		r.ResourceName,
+		ResourceType(r.ResourceID),
+		ServiceCategory(r.ServiceName),
+		r.ServiceName,
+		r.SkuID,
+		r.SubAccountID,
+		r.SubAccountName,
+		string(tags),
+		r.BillPeriod,
+		r.MeterSubCategory,
+	}, nil
+}
@@ -0,0 +1,252 @@
+package forecast
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/aggregate"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+// DefaultHistory - Number of complete days the models are fitted on when not configured
+const DefaultHistory = 28
+
+// UntaggedValue - Tag value forecast for points without one, so their series stays apart from the
+// subscription total once written
+const UntaggedValue = "(untagged)"
+
+// z - Two sided 95% normal quantile used for the confidence bounds
+const z = 1.96
+
+// History - Returns the configured history length, falling back to the default
+func History(config *domain.ForecastConfig) int {
+	if config.History <= 0 {
+		return DefaultHistory
+	}
+
+	return config.History
+}
+
+// WindowStart - First day the forecast needs in the extracted points
+func WindowStart(config *domain.ForecastConfig, now time.Time) time.Time {
+	today := aggregate.PeriodStart(now, "daily")
+
+	start := today.AddDate(0, 0, -History(config))
+	if monthStart := aggregate.PeriodStart(now, "monthly"); monthStart.Before(start) {
+		return monthStart
+	}
+
+	return start
+}
+
+// Validate - Ensures the forecast tag is an aggregation dimension, otherwise every point carries an
+// empty value for it
+func Validate(config *domain.Config) (err error) {
+	if config.Forecast == nil || len(config.Forecast.TagKey) == 0 {
+		return nil
+	}
+
+	tagKey := fmt.Sprintf("_%s", strings.TrimPrefix(config.Forecast.TagKey, "_"))
+	for _, dimension := range aggregate.Dimensions(config) {
+		if dimension == tagKey {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("forecast tag %s is not an aggregation dimension", tagKey)
+}
+
+type series struct {
+	subscription string
+	total        bool
+	tagValue     string
+	days         map[string]float64
+}
+
+// Project - Forecasts end-of-month spend per subscription, and per tag value when configured, with a
+// linear model and a weekday seasonal model. Today is treated as incomplete and is forecast
+func Project(points []*domain.Point, config *domain.ForecastConfig, now time.Time) (forecasts []*domain.Forecast) {
+	today := aggregate.PeriodStart(now, "daily")
+	monthStart := aggregate.PeriodStart(now, "monthly")
+	monthEnd := monthStart.AddDate(0, 1, 0)
+	historyStart := today.AddDate(0, 0, -History(config))
+	tagKey := fmt.Sprintf("_%s", strings.TrimPrefix(config.TagKey, "_"))
+
+	data := make(map[string]*series)
+	add := func(subscription string, total bool, tagValue string, date string, cost float64) {
+		key := fmt.Sprintf("%s/%t/%s", subscription, total, tagValue)
+		s, found := data[key]
+		if !found {
+			s = &series{subscription: subscription, total: total, tagValue: tagValue, days: make(map[string]float64)}
+			data[key] = s
+		}
+		s.days[date] += cost
+	}
+
+	for _, point := range points {
+		day := aggregate.PeriodStart(point.Timestamp, "daily")
+		if !day.Before(today) || (day.Before(historyStart) && day.Before(monthStart)) {
+			continue
+		}
+
+		date := day.Format("2006-01-02")
+		cost := point.Cost.InexactFloat64()
+		add(point.Subscription, true, "", date, cost)
+		if len(config.TagKey) > 0 {
+			tagValue := point.Tags[tagKey]
+			if len(tagValue) == 0 {
+				tagValue = UntaggedValue
+			}
+			add(point.Subscription, false, tagValue, date, cost)
+		}
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := data[key]
+
+		monthToDate := 0.0
+		for day := monthStart; day.Before(today); day = day.AddDate(0, 0, 1) {
+			monthToDate += s.days[day.Format("2006-01-02")]
+		}
+
+		var xs, ys []float64
+		var weekdays []time.Weekday
+		index := 0
+		for day := historyStart; day.Before(today); day, index = day.AddDate(0, 0, 1), index+1 {
+			cost, found := s.days[day.Format("2006-01-02")]
+			if !found && len(xs) == 0 {
+				continue
+			}
+
+			xs = append(xs, float64(index))
+			ys = append(ys, cost)
+			weekdays = append(weekdays, day.Weekday())
+		}
+
+		if len(xs) < 2 {
+			continue
+		}
+
+		var remaining []float64
+		var remainingDays []time.Weekday
+		for day := today; day.Before(monthEnd); day, index = day.AddDate(0, 0, 1), index+1 {
+			remaining = append(remaining, float64(index))
+			remainingDays = append(remainingDays, day.Weekday())
+		}
+
+		for _, model := range []string{"linear", "seasonal"} {
+			factors := map[time.Weekday]float64{}
+			if model == "seasonal" {
+				factors = weekdayFactors(ys, weekdays)
+			}
+
+			projected, halfWidth := project(xs, ys, weekdays, remaining, remainingDays, factors)
+
+			f := &domain.Forecast{
+				Subscription: s.subscription,
+				TagValue:     s.tagValue,
+				Model:        model,
+				Timestamp:    today,
+				MonthToDate:  monthToDate,
+				Forecast:     monthToDate + projected,
+			}
+			f.Lower = math.Max(monthToDate, f.Forecast-halfWidth)
+			f.Upper = f.Forecast + halfWidth
+			if !s.total {
+				f.TagKey = tagKey
+			}
+
+			forecasts = append(forecasts, f)
+		}
+	}
+
+	return forecasts
+}
+
+// project - Fits a least squares line to the deseasonalised history and sums its projection over the
+// remaining days, returning the half width of the confidence interval of that sum
+func project(xs, ys []float64, weekdays []time.Weekday, remaining []float64, remainingDays []time.Weekday, factors map[time.Weekday]float64) (projected, halfWidth float64) {
+	factor := func(w time.Weekday) float64 {
+		if v, ok := factors[w]; ok && v > 0 {
+			return v
+		}
+
+		return 1
+	}
+
+	adjusted := make([]float64, len(ys))
+	for i := range ys {
+		adjusted[i] = ys[i] / factor(weekdays[i])
+	}
+
+	intercept, slope := fit(xs, adjusted)
+
+	variance := 0.0
+	for i := range xs {
+		residual := ys[i] - (intercept+slope*xs[i])*factor(weekdays[i])
+		variance += residual * residual
+	}
+	if len(xs) > 2 {
+		variance /= float64(len(xs) - 2)
+	}
+
+	for i, x := range remaining {
+		projected += math.Max(0, (intercept+slope*x)*factor(remainingDays[i]))
+	}
+	halfWidth = z * math.Sqrt(variance*float64(len(remaining)))
+
+	return projected, halfWidth
+}
+
+func fit(xs, ys []float64) (intercept, slope float64) {
+	n := float64(len(xs))
+
+	var sx, sy, sxx, sxy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		sxy += xs[i] * ys[i]
+	}
+
+	if d := n*sxx - sx*sx; d != 0 {
+		slope = (n*sxy - sx*sy) / d
+	}
+	intercept = (sy - slope*sx) / n
+
+	return intercept, slope
+}
+
+// weekdayFactors - Ratio of the mean cost of each weekday to the overall mean cost
+func weekdayFactors(ys []float64, weekdays []time.Weekday) (factors map[time.Weekday]float64) {
+	factors = make(map[time.Weekday]float64)
+
+	total := 0.0
+	sums := make(map[time.Weekday]float64)
+	counts := make(map[time.Weekday]float64)
+	for i, y := range ys {
+		total += y
+		sums[weekdays[i]] += y
+		counts[weekdays[i]]++
+	}
+
+	mean := total / float64(len(ys))
+	if mean <= 0 {
+		return factors
+	}
+
+	for w, sum := range sums {
+		factors[w] = sum / counts[w] / mean
+	}
+
+	return factors
+}
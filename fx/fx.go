@@ -0,0 +1,266 @@
+package fx
+
+import (
+	gocsv "encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
+)
+
+var fieldPattern = regexp.MustCompile(`^(Cost|AmortisedCost)_([A-Z]{3})$`)
+
+// Provider - Supplies the rate converting one unit of a currency into another on a date
+type Provider interface {
+	Rate(from, to string, date time.Time) (rate float64, err error)
+}
+
+// New - Creates the provider described by config
+func New(config *domain.FXConfig) (p Provider, err error) {
+	if config == nil {
+		return nil, errors.New("reporting currencies require an fx configuration")
+	}
+
+	switch config.Type {
+	case "file":
+		if len(config.Path) == 0 {
+			return nil, errors.New("file fx provider requires a path")
+		}
+		return &lazyTable{load: func() ([]*domain.FXRate, error) { return LoadFile(config.Path) }}, nil
+	case "http":
+		if len(config.URL) == 0 {
+			return nil, errors.New("http fx provider requires a url")
+		}
+		return &lazyTable{load: func() ([]*domain.FXRate, error) { return fetch(config) }}, nil
+	}
+
+	return nil, fmt.Errorf("unknown fx provider type: %s", config.Type)
+}
+
+// Field - Name of a cost field converted into a currency, e.g. Cost_ZAR
+func Field(field, currency string) string {
+	return fmt.Sprintf("%s_%s", field, strings.ToUpper(currency))
+}
+
+// IsField - Reports whether name is a converted cost field
+func IsField(name string) bool {
+	return fieldPattern.MatchString(name)
+}
+
+// Convert - Adds the cost fields of every point converted into each reporting currency at the rate
+// effective on the point's date
+func Convert(points []*domain.Point, provider Provider, currencies []string) (err error) {
+	for _, point := range points {
+		point.Converted = make(map[string]decimal.Decimal)
+
+		for _, currency := range currencies {
+			rate, err := provider.Rate(point.Currency, currency, point.Timestamp)
+			if err != nil {
+				return err
+			}
+
+			point.Converted[Field("Cost", currency)] = point.Cost.Mul(decimal.NewFromFloat(rate))
+			point.Converted[Field("AmortisedCost", currency)] = point.AmortisedCost.Mul(decimal.NewFromFloat(rate))
+		}
+	}
+
+	return nil
+}
+
+// Table - Dated rates per currency pair, sorted by date
+type Table struct {
+	pairs map[string][]*rate
+}
+
+type rate struct {
+	date  time.Time
+	value float64
+}
+
+// NewTable - Indexes rates by currency pair
+func NewTable(rates []*domain.FXRate) (t *Table, err error) {
+	t = &Table{pairs: make(map[string][]*rate)}
+
+	for _, r := range rates {
+		date, err := time.Parse("2006-01-02", r.Date)
+		if err != nil {
+			return nil, fmt.Errorf("fx rate %s/%s: %v", r.From, r.To, err)
+		}
+
+		if r.Rate <= 0 {
+			return nil, fmt.Errorf("fx rate %s/%s on %s: rate must be positive", r.From, r.To, r.Date)
+		}
+
+		key := pair(r.From, r.To)
+		t.pairs[key] = append(t.pairs[key], &rate{date: date, value: r.Rate})
+	}
+
+	for _, rates := range t.pairs {
+		sort.Slice(rates, func(i, j int) bool { return rates[i].date.Before(rates[j].date) })
+	}
+
+	return t, nil
+}
+
+// Rate - Latest rate of the pair on or before date, using the inverse pair when only that is known
+func (t *Table) Rate(from, to string, date time.Time) (value float64, err error) {
+	if strings.EqualFold(from, to) {
+		return 1, nil
+	}
+
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+
+	if r := latest(t.pairs[pair(from, to)], day); r != nil {
+		return r.value, nil
+	}
+
+	if r := latest(t.pairs[pair(to, from)], day); r != nil {
+		return 1 / r.value, nil
+	}
+
+	return 0, fmt.Errorf("no fx rate from %s to %s on %s", from, to, day.Format("2006-01-02"))
+}
+
+func latest(rates []*rate, day time.Time) (found *rate) {
+	for _, r := range rates {
+		if r.date.After(day) {
+			break
+		}
+		found = r
+	}
+
+	return found
+}
+
+func pair(from, to string) string {
+	return fmt.Sprintf("%s/%s", strings.ToUpper(from), strings.ToUpper(to))
+}
+
+// lazyTable - Loads its rate table on first use
+type lazyTable struct {
+	load  func() ([]*domain.FXRate, error)
+	once  sync.Once
+	table *Table
+	err   error
+}
+
+func (l *lazyTable) Rate(from, to string, date time.Time) (value float64, err error) {
+	if strings.EqualFold(from, to) {
+		return 1, nil
+	}
+
+	l.once.Do(func() {
+		rates, err := l.load()
+		if err != nil {
+			l.err = err
+			return
+		}
+
+		l.table, l.err = NewTable(rates)
+	})
+
+	if l.err != nil {
+		return 0, l.err
+	}
+
+	return l.table.Rate(from, to, date)
+}
+
+// LoadFile - Reads a rate table from a JSON list or from a CSV file with Date, From, To and Rate columns
+func LoadFile(path string) (rates []*domain.FXRate, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		rates, err = readCSV(file)
+	} else {
+		err = json.NewDecoder(file).Decode(&rates)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return rates, nil
+}
+
+func readCSV(r io.Reader) (rates []*domain.FXRate, err error) {
+	records, err := gocsv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	index := make(map[string]int)
+	for i, column := range records[0] {
+		index[strings.TrimSpace(column)] = i
+	}
+
+	for _, column := range []string{"Date", "From", "To", "Rate"} {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("missing column %s", column)
+		}
+	}
+
+	for _, record := range records[1:] {
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[index["Rate"]]), 64)
+		if err != nil {
+			return nil, err
+		}
+
+		rates = append(rates, &domain.FXRate{
+			Date: strings.TrimSpace(record[index["Date"]]),
+			From: strings.TrimSpace(record[index["From"]]),
+			To:   strings.TrimSpace(record[index["To"]]),
+			Rate: value,
+		})
+	}
+
+	return rates, nil
+}
+
+func fetch(config *domain.FXConfig) (rates []*domain.FXRate, err error) {
+	req, err := http.NewRequest("GET", config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fx rates %s: %s", config.URL, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&rates); err != nil {
+		return nil, fmt.Errorf("fx rates %s: %v", config.URL, err)
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,158 @@
+package fx
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
+)
+
+var rates = []*domain.FXRate{
+	{Date: "2026-10-05", From: "USD", To: "ZAR", Rate: 18},
+	{Date: "2026-10-01", From: "usd", To: "zar", Rate: 17.5},
+	{Date: "2026-10-01", From: "EUR", To: "USD", Rate: 1.25},
+}
+
+func day(d int) time.Time {
+	return time.Date(2026, 10, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestTableRate(t *testing.T) {
+	table, err := NewTable(rates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		from, to string
+		date     time.Time
+		expected float64
+	}{
+		{"USD", "ZAR", day(3), 17.5},
+		{"USD", "ZAR", day(5), 18},
+		{"USD", "ZAR", day(20), 18},
+		{"USD", "EUR", day(2), 0.8},
+		{"ZAR", "ZAR", day(1), 1},
+	}
+
+	for _, test := range tests {
+		rate, err := table.Rate(test.from, test.to, test.date)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if math.Abs(rate-test.expected) > 1e-9 {
+			t.Errorf("%s/%s on %s: expected %v, got %v", test.from, test.to, test.date.Format("2006-01-02"), test.expected, rate)
+		}
+	}
+
+	if _, err := table.Rate("USD", "ZAR", time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("expected no rate before the first date")
+	}
+
+	if _, err := table.Rate("USD", "GBP", day(2)); err == nil {
+		t.Error("expected no rate for an unknown pair")
+	}
+}
+
+func TestNewTableRejectsInvalidRates(t *testing.T) {
+	for _, r := range []*domain.FXRate{{Date: "01/10/2026", From: "USD", To: "ZAR", Rate: 1}, {Date: "2026-10-01", From: "USD", To: "ZAR"}} {
+		if _, err := NewTable([]*domain.FXRate{r}); err == nil {
+			t.Errorf("expected %+v to be rejected", r)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	table, err := NewTable(rates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	point := &domain.Point{Cost: decimal.NewFromInt(10), AmortisedCost: decimal.NewFromInt(4), Currency: "USD", Timestamp: day(6)}
+	if err := Convert([]*domain.Point{point}, table, []string{"zar", "USD"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]decimal.Decimal{
+		"Cost_ZAR":          decimal.NewFromInt(180),
+		"AmortisedCost_ZAR": decimal.NewFromInt(72),
+		"Cost_USD":          decimal.NewFromInt(10),
+		"AmortisedCost_USD": decimal.NewFromInt(4),
+	}
+	for field, value := range expected {
+		if !point.Converted[field].Equal(value) {
+			t.Errorf("%s: expected %s, got %s", field, value, point.Converted[field])
+		}
+
+		if !IsField(field) {
+			t.Errorf("expected %s to be a converted field", field)
+		}
+	}
+
+	if IsField("Cost") || IsField("Cost_zar") {
+		t.Error("expected only upper case currency suffixes to be converted fields")
+	}
+}
+
+func TestProviders(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "rates.csv")
+	if err := ioutil.WriteFile(csvPath, []byte("Date, From, To, Rate\n2026-10-01,USD,ZAR, 17.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "unauthorised", http.StatusUnauthorized)
+			return
+		}
+
+		json.NewEncoder(w).Encode(rates)
+	}))
+	defer server.Close()
+
+	configs := []*domain.FXConfig{
+		{Type: "file", Path: csvPath},
+		{Type: "http", URL: server.URL, Headers: map[string]string{"Authorization": "Bearer key"}},
+	}
+
+	for _, config := range configs {
+		provider, err := New(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2; i++ {
+			rate, err := provider.Rate("USD", "ZAR", day(2))
+			if err != nil {
+				t.Fatalf("%s: %v", config.Type, err)
+			}
+
+			if rate != 17.5 {
+				t.Errorf("%s: expected 17.5, got %v", config.Type, rate)
+			}
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("expected the http rates to be fetched once, got %d requests", requests)
+	}
+
+	for _, config := range []*domain.FXConfig{nil, {Type: "file"}, {Type: "http"}, {Type: "ftp"}} {
+		if _, err := New(config); err == nil {
+			t.Errorf("expected %+v to be rejected", config)
+		}
+	}
+}
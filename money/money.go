@@ -0,0 +1,69 @@
+package money
+
+import (
+	"fmt"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultDecimals - Decimal places written when the configuration does not specify any
+const DefaultDecimals = 6
+
+// DefaultMode - Rounding mode used when the configuration does not specify one
+const DefaultMode = "half-up"
+
+// Rounder - Rounds money to a fixed number of decimal places when it is written out. Arithmetic
+// keeps full precision, only the sinks round
+type Rounder struct {
+	Decimals int32
+	Mode     string
+}
+
+// NewRounder - Creates the rounder described by the configuration: half-up rounds halves away from
+// zero, half-even rounds halves to the even digit and down truncates
+func NewRounder(config *domain.Config) (r Rounder, err error) {
+	r = Rounder{Decimals: DefaultDecimals, Mode: config.RoundingMode}
+	if config.CostDecimals != nil {
+		r.Decimals = *config.CostDecimals
+	}
+
+	if len(r.Mode) == 0 {
+		r.Mode = DefaultMode
+	}
+
+	if r.Decimals < 0 {
+		return r, fmt.Errorf("cost decimals must not be negative: %d", r.Decimals)
+	}
+
+	switch r.Mode {
+	case "half-up", "half-even", "down":
+	default:
+		return r, fmt.Errorf("unknown rounding mode: %s", r.Mode)
+	}
+
+	return r, nil
+}
+
+// Round - Rounds a value to the configured decimal places
+func (r Rounder) Round(value decimal.Decimal) decimal.Decimal {
+	switch r.Mode {
+	case "half-even":
+		return value.RoundBank(r.Decimals)
+	case "down":
+		return value.Truncate(r.Decimals)
+	}
+
+	return value.Round(r.Decimals)
+}
+
+// Format - Rounded value with exactly the configured decimal places
+func (r Rounder) Format(value decimal.Decimal) string {
+	return r.Round(value).StringFixed(r.Decimals)
+}
+
+// Float - Rounded value for sinks that only store floating point numbers
+func (r Rounder) Float(value decimal.Decimal) float64 {
+	return r.Round(value).InexactFloat64()
+}
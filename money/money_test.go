@@ -0,0 +1,60 @@
+package money
+
+import (
+	"testing"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRounderModes(t *testing.T) {
+	tests := []struct {
+		mode   string
+		value  string
+		format string
+		float  float64
+	}{
+		{"half-up", "1.005", "1.01", 1.01},
+		{"half-up", "1.015", "1.02", 1.02},
+		{"half-up", "-1.005", "-1.01", -1.01},
+		{"half-even", "1.005", "1.00", 1},
+		{"half-even", "1.015", "1.02", 1.02},
+		{"half-even", "-1.025", "-1.02", -1.02},
+		{"down", "1.009", "1.00", 1},
+		{"down", "-1.009", "-1.00", -1},
+		{"", "2.345", "2.35", 2.35},
+	}
+
+	decimals := int32(2)
+	for _, test := range tests {
+		r, err := NewRounder(&domain.Config{CostDecimals: &decimals, RoundingMode: test.mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		value := decimal.RequireFromString(test.value)
+		if format := r.Format(value); format != test.format {
+			t.Errorf("%s %s: expected format %s, got %s", test.mode, test.value, test.format, format)
+		}
+
+		if float := r.Float(value); float != test.float {
+			t.Errorf("%s %s: expected float %v, got %v", test.mode, test.value, test.float, float)
+		}
+	}
+}
+
+func TestRounderDefaults(t *testing.T) {
+	r, err := NewRounder(&domain.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if format := r.Format(decimal.RequireFromString("0.1234565")); format != "0.123457" {
+		t.Errorf("expected 6 decimals rounded half-up, got %s", format)
+	}
+
+	if _, err := NewRounder(&domain.Config{RoundingMode: "up"}); err == nil {
+		t.Error("expected an unknown rounding mode to fail")
+	}
+}
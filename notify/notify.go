@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/state"
+)
+
+// Notifier - Delivers an alert to a destination
+type Notifier interface {
+	Notify(alert *domain.Alert) (err error)
+}
+
+// New - Creates the notifier described by config
+func New(config *domain.NotifierConfig) (n Notifier, err error) {
+	switch config.Type {
+	case "webhook":
+		if len(config.URL) == 0 {
+			return nil, errors.New("webhook notifier requires a url")
+		}
+		return &webhook{config: config}, nil
+	case "smtp":
+		if len(config.Host) == 0 || len(config.From) == 0 || len(config.To) == 0 {
+			return nil, errors.New("smtp notifier requires host, from and to")
+		}
+		return &mail{config: config}, nil
+	case "file":
+		if len(config.Path) == 0 {
+			return nil, errors.New("file notifier requires a path")
+		}
+		return &file{config: config}, nil
+	}
+
+	return nil, fmt.Errorf("unknown notifier type: %s", config.Type)
+}
+
+// NewAll - Creates a notifier for every configuration
+func NewAll(configs []*domain.NotifierConfig) (notifiers []Notifier, err error) {
+	for _, config := range configs {
+		n, err := New(config)
+		if err != nil {
+			return nil, err
+		}
+
+		notifiers = append(notifiers, n)
+	}
+
+	return notifiers, nil
+}
+
+// Dispatch - Sends the alerts that have not fired before to every notifier, recording each alert in
+// the state once all notifiers accepted it. Without notifiers nothing is sent or recorded
+func Dispatch(notifiers []Notifier, alerts []*domain.Alert, s *state.State) (sent int, err error) {
+	if len(notifiers) == 0 {
+		return 0, nil
+	}
+
+	var failures []string
+
+	for _, alert := range alerts {
+		if _, fired := s.Alerts[alert.ID]; fired {
+			continue
+		}
+
+		ok := true
+		for _, n := range notifiers {
+			if err := n.Notify(alert); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", alert.ID, err))
+				ok = false
+			}
+		}
+
+		if ok {
+			s.Alerts[alert.ID] = alert.Timestamp
+			sent++
+		}
+	}
+
+	if len(failures) > 0 {
+		return sent, errors.New(strings.Join(failures, "; "))
+	}
+
+	return sent, nil
+}
+
+type webhook struct {
+	config *domain.NotifierConfig
+}
+
+func (w *webhook) Notify(alert *domain.Alert) (err error) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	for key, value := range w.config.Headers {
+		req.Header.Add(key, value)
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook returned %d: %s", resp.StatusCode, string(data))
+	}
+
+	return nil
+}
+
+type mail struct {
+	config *domain.NotifierConfig
+}
+
+func (m *mail) Notify(alert *domain.Alert) (err error) {
+	port := m.config.Port
+	if port == 0 {
+		port = 25
+	}
+
+	var auth smtp.Auth
+	if len(m.config.Username) > 0 {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", m.config.From, strings.Join(m.config.To, ", "), alert.Subject, alert.Message)
+
+	return smtp.SendMail(fmt.Sprintf("%s:%d", m.config.Host, port), auth, m.config.From, m.config.To, []byte(msg))
+}
+
+type file struct {
+	config *domain.NotifierConfig
+}
+
+func (f *file) Notify(alert *domain.Alert) (err error) {
+	if err := os.MkdirAll(filepath.Dir(f.config.Path), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(f.config.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return json.NewEncoder(out).Encode(alert)
+}
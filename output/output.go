@@ -0,0 +1,120 @@
+package output
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultDir - Directory used when the configuration does not specify one
+const DefaultDir = "data"
+
+// DefaultFormats - Export formats used when the configuration does not specify any
+var DefaultFormats = []string{"csv"}
+
+// KnownFormats - Export formats the exporter can write
+var KnownFormats = []string{"csv", "focus", "focus-raw", "parquet"}
+
+// File - Temporary file that replaces its target path on Commit
+type File struct {
+	*os.File
+	path      string
+	committed bool
+}
+
+// Dir - Returns the configured output directory, falling back to the default
+func Dir(dir string) string {
+	if len(dir) == 0 {
+		return DefaultDir
+	}
+
+	return dir
+}
+
+// Formats - Returns the set of configured export formats, falling back to the defaults
+func Formats(formats []string) map[string]bool {
+	if len(formats) == 0 {
+		formats = DefaultFormats
+	}
+
+	set := make(map[string]bool)
+	for _, format := range formats {
+		set[format] = true
+	}
+
+	return set
+}
+
+// ValidateFormats - Ensures every configured export format is known
+func ValidateFormats(formats []string) (err error) {
+	known := make(map[string]bool)
+	for _, format := range KnownFormats {
+		known[format] = true
+	}
+
+	for _, format := range formats {
+		if !known[format] {
+			return fmt.Errorf("unknown output format: %s", format)
+		}
+	}
+
+	return nil
+}
+
+// FileName - Builds the export file name for a subscription and date range
+func FileName(subscription string, fromDate, toDate time.Time, ext string) string {
+	return fmt.Sprintf("_%s_%s_%s.%s", subscription, fromDate.Format("2006-01-02"), toDate.Format("2006-01-02"), ext)
+}
+
+// Create - Creates the directory of path if missing and opens a temporary file next to it
+func Create(path string) (file *File, err error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempFile(dir, fmt.Sprintf(".%s.*.tmp", filepath.Base(path)))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	return &File{File: tmp, path: path}, nil
+}
+
+// Commit - Flushes the temporary file to disk and renames it over the target path
+func (f *File) Commit() (err error) {
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.File.Name(), f.path); err != nil {
+		return err
+	}
+
+	f.committed = true
+
+	return nil
+}
+
+// Close - Discards the temporary file unless it has been committed
+func (f *File) Close() (err error) {
+	if f.committed {
+		return nil
+	}
+
+	f.File.Close()
+
+	return os.Remove(f.File.Name())
+}
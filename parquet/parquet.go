@@ -0,0 +1,138 @@
+package parquet
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/money"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/output"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type row struct {
+	SubscriptionID   string             `parquet:"name=subscription_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Subscription     string             `parquet:"name=subscription, type=BYTE_ARRAY, convertedtype=UTF8"`
+	MeterID          string             `parquet:"name=meter_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	MeterCategory    string             `parquet:"name=meter_category, type=BYTE_ARRAY, convertedtype=UTF8"`
+	MeterSubCategory string             `parquet:"name=meter_sub_category, type=BYTE_ARRAY, convertedtype=UTF8"`
+	MeterRegion      string             `parquet:"name=meter_region, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Location         string             `parquet:"name=location, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ResourceGroup    string             `parquet:"name=resource_group, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Resource         string             `parquet:"name=resource, type=BYTE_ARRAY, convertedtype=UTF8"`
+	BillPeriod       string             `parquet:"name=bill_period, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Quantity         float64            `parquet:"name=quantity, type=DOUBLE"`
+	Cost             float64            `parquet:"name=cost, type=DOUBLE"`
+	AmortisedCost    float64            `parquet:"name=amortised_cost, type=DOUBLE"`
+	UnitPrice        float64            `parquet:"name=unit_price, type=DOUBLE"`
+	PricingRule      string             `parquet:"name=pricing_rule, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Currency         string             `parquet:"name=currency, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Timestamp        int64              `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Tags             map[string]string  `parquet:"name=tags, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Converted        map[string]float64 `parquet:"name=converted, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=DOUBLE"`
+	TagSources       map[string]string  `parquet:"name=tag_sources, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+}
+
+// Writer - Collects points and writes them as Parquet files partitioned by subscription and month,
+// with one file per day so a run covering a day again replaces its file rather than adding another
+type Writer struct {
+	dir          string
+	subscription string
+	rounder      money.Rounder
+	files        map[string][]*domain.Point
+}
+
+func NewWriter(dir, subscription string, rounder money.Rounder) *Writer {
+	return &Writer{
+		dir:          dir,
+		subscription: subscription,
+		rounder:      rounder,
+		files:        make(map[string][]*domain.Point),
+	}
+}
+
+// Add - Queues points for the file of their day in their subscription and month partition
+func (w *Writer) Add(points []*domain.Point) {
+	for _, point := range points {
+		day := time.Date(point.Timestamp.Year(), point.Timestamp.Month(), point.Timestamp.Day(), 0, 0, 0, 0, point.Timestamp.Location())
+		partition := filepath.Join(fmt.Sprintf("subscription=%s", point.Subscription), fmt.Sprintf("month=%s", point.Timestamp.Format("2006-01")))
+		file := filepath.Join(partition, output.FileName(w.subscription, day, day.AddDate(0, 0, 1), "parquet"))
+		w.files[file] = append(w.files[file], point)
+	}
+}
+
+// Write - Writes one file per partition and day, returning the paths written
+func (w *Writer) Write() (paths []string, err error) {
+	files := make([]string, 0, len(w.files))
+	for file := range w.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		path := filepath.Join(w.dir, file)
+		if err := writeFile(path, w.files[file], w.rounder); err != nil {
+			return paths, err
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+func writeFile(path string, points []*domain.Point, rounder money.Rounder) (err error) {
+	file, err := output.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	pw, err := writer.NewParquetWriterFromWriter(file, new(row), 1)
+	if err != nil {
+		return err
+	}
+
+	for _, point := range points {
+		converted := make(map[string]float64)
+		for field, value := range point.Converted {
+			converted[field] = rounder.Float(value)
+		}
+
+		r := &row{
+			SubscriptionID:   point.SubscriptionID,
+			Subscription:     point.Subscription,
+			MeterID:          point.MeterID,
+			MeterCategory:    point.MeterCategory,
+			MeterSubCategory: point.MeterSubCategory,
+			MeterRegion:      point.MeterRegion,
+			Location:         point.Location,
+			ResourceGroup:    point.ResourceGroup,
+			Resource:         point.Resource,
+			BillPeriod:       point.BillPeriod,
+			Quantity:         point.Quantity,
+			Cost:             rounder.Float(point.Cost),
+			AmortisedCost:    rounder.Float(point.AmortisedCost),
+			UnitPrice:        rounder.Float(point.UnitPrice),
+			PricingRule:      point.PricingRule,
+			Currency:         point.Currency,
+			Timestamp:        point.Timestamp.UnixNano() / 1e6,
+			Tags:             point.Tags,
+			Converted:        converted,
+			TagSources:       point.TagSources,
+		}
+
+		if err := pw.Write(r); err != nil {
+			return err
+		}
+	}
+
+	if err := pw.WriteStop(); err != nil {
+		return err
+	}
+
+	return file.Commit()
+}
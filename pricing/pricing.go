@@ -0,0 +1,109 @@
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
+)
+
+// RateCardRule - Rule name recorded on records priced from the RateCard with the global RateMultiply
+const RateCardRule = "RateCard"
+
+// Load - Reads a price-sheet override file holding a JSON list of pricing rules
+func Load(path string) (rules []*domain.PricingRule, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return rules, nil
+}
+
+// Validate - Ensures every rule has a unique name, a valid price and either a MeterID or valid patterns
+func Validate(rules []*domain.PricingRule) (err error) {
+	names := make(map[string]bool)
+
+	for _, rule := range rules {
+		if len(rule.Name) == 0 {
+			return fmt.Errorf("pricing rule without a name")
+		}
+
+		if names[rule.Name] || rule.Name == RateCardRule {
+			return fmt.Errorf("pricing rule %s: duplicate name", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Rate == nil && rule.Multiply <= 0 {
+			return fmt.Errorf("pricing rule %s: needs a rate or a positive multiply", rule.Name)
+		}
+
+		if rule.Rate != nil && *rule.Rate < 0 {
+			return fmt.Errorf("pricing rule %s: rate must not be negative", rule.Name)
+		}
+
+		patterns := []string{rule.MeterCategory, rule.MeterSubCategory, rule.MeterRegion}
+		for _, pattern := range patterns {
+			if len(rule.MeterID) > 0 && len(pattern) > 0 {
+				return fmt.Errorf("pricing rule %s: meterId can not be combined with patterns", rule.Name)
+			}
+
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("pricing rule %s: %v", rule.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Match - Returns the rule pricing a record: a rule for its exact MeterID wins, otherwise the first
+// pattern rule in file order that matches its category, sub-category and region
+func Match(rules []*domain.PricingRule, record *domain.UsageRecord) *domain.PricingRule {
+	for _, rule := range rules {
+		if len(rule.MeterID) > 0 && strings.EqualFold(rule.MeterID, record.Properties.MeterID) {
+			return rule
+		}
+	}
+
+	for _, rule := range rules {
+		if len(rule.MeterID) > 0 {
+			continue
+		}
+
+		if matches(rule.MeterCategory, record.Properties.MeterCategory) &&
+			matches(rule.MeterSubCategory, record.Properties.MeterSubCategory) &&
+			matches(rule.MeterRegion, record.Properties.MeterRegion) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// Rate - Price per unit of a rule given the RateCard rate of the meter
+func Rate(rule *domain.PricingRule, rateCard decimal.Decimal) decimal.Decimal {
+	if rule.Rate != nil {
+		return decimal.NewFromFloat(*rule.Rate)
+	}
+
+	return rateCard.Mul(decimal.NewFromFloat(rule.Multiply))
+}
+
+func matches(pattern, value string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return ok
+}
@@ -0,0 +1,102 @@
+package pricing
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
+)
+
+func pricedRecord(meterID, category, subCategory, region string) *domain.UsageRecord {
+	record := &domain.UsageRecord{}
+	record.Properties.MeterID = meterID
+	record.Properties.MeterCategory = category
+	record.Properties.MeterSubCategory = subCategory
+	record.Properties.MeterRegion = region
+
+	return record
+}
+
+func TestMatchPrefersMeterIDThenFileOrder(t *testing.T) {
+	rate := 0.5
+	rules := []*domain.PricingRule{
+		{Name: "storage", MeterCategory: "storage", Multiply: 0.9},
+		{Name: "vm-eu", MeterCategory: "Virtual Machines", MeterRegion: "EU *", Multiply: 0.8},
+		{Name: "vm", MeterCategory: "Virtual*", Multiply: 0.85},
+		{Name: "meter", MeterID: "ABC-123", Rate: &rate},
+	}
+
+	tests := []struct {
+		record   *domain.UsageRecord
+		expected string
+	}{
+		{pricedRecord("abc-123", "Virtual Machines", "D2", "EU West"), "meter"},
+		{pricedRecord("m1", "Virtual Machines", "D2", "EU West"), "vm-eu"},
+		{pricedRecord("m2", "Virtual Machines", "D2", "US East"), "vm"},
+		{pricedRecord("m3", "Storage", "Blob", "US East"), "storage"},
+	}
+
+	for _, test := range tests {
+		rule := Match(rules, test.record)
+		if rule == nil || rule.Name != test.expected {
+			t.Errorf("%s: expected rule %s, got %+v", test.record.Properties.MeterID, test.expected, rule)
+		}
+	}
+
+	if rule := Match(rules, pricedRecord("m4", "Bandwidth", "", "")); rule != nil {
+		t.Errorf("expected no rule, got %s", rule.Name)
+	}
+}
+
+func TestRate(t *testing.T) {
+	rate := 0.5
+	if r := Rate(&domain.PricingRule{Rate: &rate}, decimal.NewFromInt(2)); !r.Equal(decimal.NewFromFloat(0.5)) {
+		t.Errorf("expected the fixed rate, got %s", r)
+	}
+
+	if r := Rate(&domain.PricingRule{Multiply: 0.75}, decimal.NewFromInt(2)); !r.Equal(decimal.NewFromFloat(1.5)) {
+		t.Errorf("expected the multiplied RateCard rate, got %s", r)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	rate, negative := 1.0, -1.0
+
+	if err := Validate([]*domain.PricingRule{{Name: "a", Rate: &rate}, {Name: "b", MeterCategory: "Storage", Multiply: 0.9}}); err != nil {
+		t.Error(err)
+	}
+
+	invalid := [][]*domain.PricingRule{
+		{{Rate: &rate}},
+		{{Name: "a", Rate: &rate}, {Name: "a", Rate: &rate}},
+		{{Name: RateCardRule, Rate: &rate}},
+		{{Name: "a"}},
+		{{Name: "a", Rate: &negative}},
+		{{Name: "a", MeterID: "m", MeterCategory: "Storage", Rate: &rate}},
+		{{Name: "a", MeterCategory: "[", Rate: &rate}},
+	}
+	for i, rules := range invalid {
+		if err := Validate(rules); err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := ioutil.WriteFile(path, []byte(`[{"name": "vm", "meterCategory": "Virtual Machines", "multiply": 0.8}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules) != 1 || rules[0].Name != "vm" || rules[0].Multiply != 0.8 {
+		t.Errorf("unexpected rules %+v", rules)
+	}
+}
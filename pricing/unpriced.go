@@ -0,0 +1,109 @@
+package pricing
+
+import (
+	"bufio"
+	gocsv "encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+// UnpricedColumns - Columns of the unpriced meters CSV
+var UnpricedColumns = []string{
+	"Date",
+	"SubscriptionID",
+	"Subscription",
+	"MeterID",
+	"MeterName",
+	"MeterCategory",
+	"MeterSubCategory",
+	"MeterRegion",
+	"Unit",
+	"Records",
+	"Quantity",
+}
+
+// Unpriced - Groups the unpriced records of a day by meter, largest record count first
+func Unpriced(records []*domain.UsageRecord, config *domain.Config, day time.Time) (meters []*domain.UnpricedMeter) {
+	data := make(map[string]*domain.UnpricedMeter)
+
+	for _, record := range records {
+		key := fmt.Sprintf("%s/%s", record.Properties.SubscriptionID, record.Properties.MeterID)
+		meter, found := data[key]
+		if !found {
+			meter = &domain.UnpricedMeter{
+				SubscriptionID:   record.Properties.SubscriptionID,
+				Subscription:     config.Subscription,
+				MeterID:          record.Properties.MeterID,
+				MeterName:        record.Properties.MeterName,
+				MeterCategory:    record.Properties.MeterCategory,
+				MeterSubCategory: record.Properties.MeterSubCategory,
+				MeterRegion:      record.Properties.MeterRegion,
+				Unit:             record.Properties.Unit,
+				Timestamp:        day,
+			}
+			data[key] = meter
+			meters = append(meters, meter)
+		}
+
+		meter.Records++
+		meter.Quantity += record.Properties.Quantity
+	}
+
+	sort.SliceStable(meters, func(i, j int) bool {
+		if meters[i].Records != meters[j].Records {
+			return meters[i].Records > meters[j].Records
+		}
+
+		return meters[i].MeterID < meters[j].MeterID
+	})
+
+	return meters
+}
+
+func WriteUnpricedHeaders(w *bufio.Writer) (err error) {
+	cw := gocsv.NewWriter(w)
+	if err := cw.Write(UnpricedColumns); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func WriteUnpriced(w *bufio.Writer, meters []*domain.UnpricedMeter) (err error) {
+	cw := gocsv.NewWriter(w)
+	for _, meter := range meters {
+		parts := []string{
+			meter.Timestamp.Format("2006-01-02"),
+			meter.SubscriptionID,
+			meter.Subscription,
+			meter.MeterID,
+			meter.MeterName,
+			meter.MeterCategory,
+			meter.MeterSubCategory,
+			meter.MeterRegion,
+			meter.Unit,
+			strconv.Itoa(meter.Records),
+			fmt.Sprintf("%f", meter.Quantity),
+		}
+
+		if err := cw.Write(parts); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,51 @@
+package pricing
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+func TestUnpricedGroupsByMeter(t *testing.T) {
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	var records []*domain.UsageRecord
+	for _, meterID := range []string{"b", "a", "c", "c", "a"} {
+		record := pricedRecord(meterID, "Storage", "Blob", "EU West")
+		record.Properties.SubscriptionID = "sub"
+		record.Properties.Quantity = 1.5
+		records = append(records, record)
+	}
+
+	meters := Unpriced(records, &domain.Config{Subscription: "Production"}, day)
+	if len(meters) != 3 {
+		t.Fatalf("expected 3 meters, got %d", len(meters))
+	}
+
+	order := []string{meters[0].MeterID, meters[1].MeterID, meters[2].MeterID}
+	if strings.Join(order, ",") != "a,c,b" {
+		t.Errorf("expected the largest record count first then by meter, got %v", order)
+	}
+
+	if meters[0].Records != 2 || meters[0].Quantity != 3 || meters[0].Subscription != "Production" {
+		t.Errorf("unexpected meter %+v", meters[0])
+	}
+
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	if err := WriteUnpricedHeaders(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteUnpriced(w, meters[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join(UnpricedColumns, ",") + "\n2026-10-01,sub,Production,a,,Storage,Blob,EU West,,2,3.000000\n"
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+}
@@ -0,0 +1,295 @@
+package reconcile
+
+import (
+	"bufio"
+	gocsv "encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/money"
+
+	"github.com/shopspring/decimal"
+)
+
+// Header aliases of the portal cost exports, in order of preference
+var (
+	subscriptionIDColumns = []string{"SubscriptionId", "SubscriptionGuid"}
+	subscriptionColumns   = []string{"SubscriptionName"}
+	categoryColumns       = []string{"MeterCategory"}
+	costColumns           = []string{"CostInBillingCurrency", "Cost", "PreTaxCost"}
+	dateColumns           = []string{"Date", "UsageDate"}
+	dateLayouts           = []string{"2006-01-02", "01/02/2006", "2006-01-02T15:04:05Z07:00", "20060102"}
+)
+
+// Variance - Difference between the computed and the invoiced cost of a meter category in a subscription
+type Variance struct {
+	SubscriptionID string
+	Subscription   string
+	MeterCategory  string
+	Computed       decimal.Decimal
+	Invoiced       decimal.Decimal
+	Difference     decimal.Decimal
+	Percent        float64
+}
+
+// ReadInvoice - Sums a cost export from the portal per subscription and meter category. Rows dated
+// outside startDate and endDate (exclusive) are skipped, exports without a date column are used whole
+func ReadInvoice(r io.Reader, startDate, endDate time.Time) (lines []*domain.InvoiceLine, err error) {
+	cr := gocsv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	for i, column := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))] = i
+	}
+
+	find := func(aliases []string) int {
+		for _, alias := range aliases {
+			if i, ok := index[strings.ToLower(alias)]; ok {
+				return i
+			}
+		}
+
+		return -1
+	}
+
+	idIndex, nameIndex := find(subscriptionIDColumns), find(subscriptionColumns)
+	categoryIndex, costIndex, dateIndex := find(categoryColumns), find(costColumns), find(dateColumns)
+	if categoryIndex < 0 || costIndex < 0 || (idIndex < 0 && nameIndex < 0) {
+		return nil, fmt.Errorf("invoice requires a subscription, MeterCategory and cost column")
+	}
+
+	data := make(map[string]*domain.InvoiceLine)
+	for {
+		parts, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		value := func(i int) string {
+			if i < 0 || i >= len(parts) {
+				return ""
+			}
+
+			return strings.TrimSpace(parts[i])
+		}
+
+		if dateIndex >= 0 {
+			date, err := parseDate(value(dateIndex), startDate.Location())
+			if err != nil {
+				return nil, err
+			}
+
+			if date.Before(startDate) || !date.Before(endDate) {
+				continue
+			}
+		}
+
+		cost, err := decimal.NewFromString(value(costIndex))
+		if err != nil {
+			return nil, fmt.Errorf("invoice cost %q: %v", value(costIndex), err)
+		}
+
+		line := &domain.InvoiceLine{
+			SubscriptionID: value(idIndex),
+			Subscription:   value(nameIndex),
+			MeterCategory:  value(categoryIndex),
+		}
+
+		key := fmt.Sprintf("%s/%s", subscriptionKey(line.SubscriptionID, line.Subscription), strings.ToLower(line.MeterCategory))
+		if existing, found := data[key]; found {
+			line = existing
+		} else {
+			data[key] = line
+		}
+		line.Cost = line.Cost.Add(cost)
+	}
+
+	for _, line := range data {
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+func parseDate(value string, loc *time.Location) (t time.Time, err error) {
+	for _, layout := range dateLayouts {
+		if t, err = time.ParseInLocation(layout, value, loc); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), nil
+		}
+	}
+
+	return t, fmt.Errorf("invoice date %q: unknown format", value)
+}
+
+func subscriptionKey(id, name string) string {
+	if len(id) > 0 {
+		return strings.ToLower(id)
+	}
+
+	return strings.ToLower(name)
+}
+
+// Compare - Sums the cost of the points between startDate and endDate (exclusive) per subscription and
+// meter category and compares it with the invoice lines. Points and lines match on the subscription ID,
+// falling back to the name when the invoice only carries names
+func Compare(points []*domain.Point, lines []*domain.InvoiceLine, startDate, endDate time.Time) (variances []*Variance) {
+	byName := true
+	for _, line := range lines {
+		byName = byName && len(line.SubscriptionID) == 0
+	}
+
+	data := make(map[string]*Variance)
+	variance := func(id, name, category string) *Variance {
+		if byName {
+			id = ""
+		}
+
+		key := fmt.Sprintf("%s/%s", subscriptionKey(id, name), strings.ToLower(category))
+		v, found := data[key]
+		if !found {
+			v = &Variance{SubscriptionID: id, Subscription: name, MeterCategory: category}
+			data[key] = v
+		}
+
+		if len(v.Subscription) == 0 {
+			v.Subscription = name
+		}
+
+		return v
+	}
+
+	for _, point := range points {
+		if point.Timestamp.Before(startDate) || !point.Timestamp.Before(endDate) {
+			continue
+		}
+
+		v := variance(point.SubscriptionID, point.Subscription, point.MeterCategory)
+		v.Computed = v.Computed.Add(point.Cost)
+	}
+
+	for _, line := range lines {
+		v := variance(line.SubscriptionID, line.Subscription, line.MeterCategory)
+		v.Invoiced = v.Invoiced.Add(line.Cost)
+	}
+
+	for _, v := range data {
+		v.Difference = v.Computed.Sub(v.Invoiced)
+		if !v.Invoiced.IsZero() {
+			v.Percent = v.Difference.Div(v.Invoiced).InexactFloat64() * 100
+		}
+
+		variances = append(variances, v)
+	}
+
+	sort.Slice(variances, func(i, j int) bool {
+		a, b := variances[i], variances[j]
+		if a.Subscription != b.Subscription {
+			return a.Subscription < b.Subscription
+		}
+
+		return a.MeterCategory < b.MeterCategory
+	})
+
+	return variances
+}
+
+// Total - Sums the variances into a single line
+func Total(variances []*Variance) (total *Variance) {
+	total = &Variance{MeterCategory: "Total"}
+
+	for _, v := range variances {
+		total.Computed = total.Computed.Add(v.Computed)
+		total.Invoiced = total.Invoiced.Add(v.Invoiced)
+	}
+
+	total.Difference = total.Computed.Sub(total.Invoiced)
+	if !total.Invoiced.IsZero() {
+		total.Percent = total.Difference.Div(total.Invoiced).InexactFloat64() * 100
+	}
+
+	return total
+}
+
+// WriteCSV - Writes one row per variance followed by the total
+func WriteCSV(w io.Writer, variances []*Variance, rounder money.Rounder) (err error) {
+	bw := bufio.NewWriter(w)
+	cw := gocsv.NewWriter(bw)
+
+	if err := cw.Write([]string{"SubscriptionID", "Subscription", "MeterCategory", "Computed", "Invoiced", "Difference", "Percent"}); err != nil {
+		return err
+	}
+
+	for _, v := range append(variances, Total(variances)) {
+		parts := []string{
+			v.SubscriptionID,
+			v.Subscription,
+			v.MeterCategory,
+			rounder.Format(v.Computed),
+			rounder.Format(v.Invoiced),
+			rounder.Format(v.Difference),
+			percent(v, "%.2f"),
+		}
+
+		if err := cw.Write(parts); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// WriteMarkdown - Renders the variances as a Markdown table, largest absolute difference first
+func WriteMarkdown(w io.Writer, variances []*Variance, currency string, month time.Time, rounder money.Rounder) (err error) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Invoice reconciliation: %s\n\n", month.Format("January 2006"))
+	fmt.Fprintf(&b, "Costs in %s, variance is computed minus invoiced.\n\n", currency)
+	b.WriteString("| Subscription | Meter Category | Computed | Invoiced | Variance | % |\n")
+	b.WriteString("|---|---|---:|---:|---:|---:|\n")
+
+	sorted := append([]*Variance(nil), variances...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Difference.Abs().GreaterThan(sorted[j].Difference.Abs())
+	})
+
+	for _, v := range sorted {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n", markdown(v.Subscription), markdown(v.MeterCategory), rounder.Format(v.Computed), rounder.Format(v.Invoiced), rounder.Format(v.Difference), percent(v, "%+.2f%%"))
+	}
+
+	total := Total(variances)
+	fmt.Fprintf(&b, "| **Total** | | **%s** | **%s** | **%s** | **%s** |\n", rounder.Format(total.Computed), rounder.Format(total.Invoiced), rounder.Format(total.Difference), percent(total, "%+.2f%%"))
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// percent - Formats the variance percentage, which is undefined for categories that were not invoiced
+func percent(v *Variance, format string) string {
+	if v.Invoiced.IsZero() {
+		return "n/a"
+	}
+
+	return fmt.Sprintf(format, v.Percent)
+}
+
+func markdown(value string) string {
+	return strings.Replace(value, "|", "\\|", -1)
+}
@@ -0,0 +1,293 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/money"
+
+	"github.com/shopspring/decimal"
+)
+
+// UntaggedValue - Section name for points that do not carry the report tag
+const UntaggedValue = "(untagged)"
+
+// Line - Spend of one meter category or resource group in the report and previous month
+type Line struct {
+	Name          string
+	Cost          float64
+	PreviousCost  float64
+	Change        float64
+	ChangePercent float64
+	cost          decimal.Decimal
+	previousCost  decimal.Decimal
+}
+
+// Section - Chargeback for a single tag value
+type Section struct {
+	TagValue   string
+	Total      *Line
+	Categories []*Line
+	Groups     []*Line
+}
+
+// Report - Monthly chargeback per value of a tag compared to the previous month
+type Report struct {
+	TagKey        string
+	Currency      string
+	Month         time.Time
+	PreviousMonth time.Time
+	Total         *Line
+	Sections      []*Section
+}
+
+// Build - Summarises the points of month and the month before it per value of tagKey
+func Build(points []*domain.Point, tagKey, currency string, month time.Time) (r *Report) {
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	previous := month.AddDate(0, -1, 0)
+	next := month.AddDate(0, 1, 0)
+
+	r = &Report{
+		TagKey:        strings.TrimPrefix(tagKey, "_"),
+		Currency:      currency,
+		Month:         month,
+		PreviousMonth: previous,
+		Total:         &Line{Name: "Total"},
+	}
+
+	sections := make(map[string]*Section)
+	categories := make(map[string]map[string]*Line)
+	groups := make(map[string]map[string]*Line)
+
+	for _, point := range points {
+		current := !point.Timestamp.Before(month) && point.Timestamp.Before(next)
+		prior := !point.Timestamp.Before(previous) && point.Timestamp.Before(month)
+		if !current && !prior {
+			continue
+		}
+
+		value := point.Tags[tagKey]
+		if len(value) == 0 {
+			value = UntaggedValue
+		}
+
+		section, found := sections[value]
+		if !found {
+			section = &Section{
+				TagValue: value,
+				Total:    &Line{Name: value},
+			}
+			sections[value] = section
+			categories[value] = make(map[string]*Line)
+			groups[value] = make(map[string]*Line)
+		}
+
+		lines := []*Line{
+			r.Total,
+			section.Total,
+			line(categories[value], point.MeterCategory),
+			line(groups[value], point.ResourceGroup),
+		}
+
+		for _, l := range lines {
+			if current {
+				l.cost = l.cost.Add(point.Cost)
+			} else {
+				l.previousCost = l.previousCost.Add(point.Cost)
+			}
+		}
+
+		if len(r.Currency) == 0 {
+			r.Currency = point.Currency
+		}
+	}
+
+	r.Total.finish()
+	for value, section := range sections {
+		section.Total.finish()
+		section.Categories = sorted(categories[value])
+		section.Groups = sorted(groups[value])
+		r.Sections = append(r.Sections, section)
+	}
+
+	sort.Slice(r.Sections, func(i, j int) bool {
+		if r.Sections[i].Total.Cost != r.Sections[j].Total.Cost {
+			return r.Sections[i].Total.Cost > r.Sections[j].Total.Cost
+		}
+
+		return r.Sections[i].TagValue < r.Sections[j].TagValue
+	})
+
+	return r
+}
+
+func line(lines map[string]*Line, name string) *Line {
+	l, found := lines[name]
+	if !found {
+		l = &Line{Name: name}
+		lines[name] = l
+	}
+
+	return l
+}
+
+func sorted(lines map[string]*Line) (result []*Line) {
+	for _, l := range lines {
+		l.finish()
+		result = append(result, l)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cost != result[j].Cost {
+			return result[i].Cost > result[j].Cost
+		}
+
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// finish - Fixes the exact sums as the displayed costs, change is taken before conversion
+func (l *Line) finish() {
+	l.Cost = l.cost.InexactFloat64()
+	l.PreviousCost = l.previousCost.InexactFloat64()
+	l.Change = l.cost.Sub(l.previousCost).InexactFloat64()
+	if l.PreviousCost != 0 {
+		l.ChangePercent = l.Change / l.PreviousCost * 100
+	}
+}
+
+// formatter - Formats the costs of lines with the configured rounding
+type formatter struct {
+	rounder money.Rounder
+}
+
+func (f formatter) cost(l *Line) string {
+	return f.rounder.Format(l.cost)
+}
+
+func (f formatter) previous(l *Line) string {
+	return f.rounder.Format(l.previousCost)
+}
+
+func (f formatter) change(l *Line) string {
+	change := f.rounder.Format(l.cost.Sub(l.previousCost))
+	if !strings.HasPrefix(change, "-") {
+		change = fmt.Sprintf("+%s", change)
+	}
+
+	return change
+}
+
+// WriteMarkdown - Renders the report as Markdown tables, costs are rounded by rounder
+func WriteMarkdown(w io.Writer, r *Report, rounder money.Rounder) (err error) {
+	var b strings.Builder
+	f := formatter{rounder: rounder}
+
+	fmt.Fprintf(&b, "# Chargeback by %s: %s\n\n", r.TagKey, r.Month.Format("January 2006"))
+	fmt.Fprintf(&b, "Costs in %s, compared to %s.\n\n", r.Currency, r.PreviousMonth.Format("January 2006"))
+	f.writeMarkdownTable(&b, r.TagKey, r.summary(), r.Total)
+
+	for _, section := range r.Sections {
+		fmt.Fprintf(&b, "\n## %s\n\n", section.TagValue)
+		f.writeMarkdownTable(&b, "Meter Category", section.Categories, section.Total)
+		b.WriteString("\n")
+		f.writeMarkdownTable(&b, "Resource Group", section.Groups, section.Total)
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func (f formatter) writeMarkdownTable(b *strings.Builder, heading string, lines []*Line, total *Line) {
+	fmt.Fprintf(b, "| %s | Cost | Previous | Change | Change %% |\n", heading)
+	b.WriteString("|---|---:|---:|---:|---:|\n")
+	for _, l := range lines {
+		fmt.Fprintf(b, "| %s | %s | %s | %s | %s |\n", strings.Replace(l.Name, "|", "\\|", -1), f.cost(l), f.previous(l), f.change(l), percent(l))
+	}
+	fmt.Fprintf(b, "| **%s** | **%s** | **%s** | **%s** | **%s** |\n", strings.Replace(total.Name, "|", "\\|", -1), f.cost(total), f.previous(total), f.change(total), percent(total))
+}
+
+func (r *Report) summary() (lines []*Line) {
+	for _, section := range r.Sections {
+		lines = append(lines, section.Total)
+	}
+
+	return lines
+}
+
+func percent(l *Line) string {
+	if l.PreviousCost == 0 {
+		return "n/a"
+	}
+
+	return fmt.Sprintf("%+.1f%%", l.ChangePercent)
+}
+
+// funcs - Template functions, the cost functions are bound to the rounder of each render
+func (f formatter) funcs() template.FuncMap {
+	return template.FuncMap{
+		"cost":     f.cost,
+		"previous": f.previous,
+		"change":   f.change,
+		"percent":  percent,
+		"table": func(heading string, lines []*Line, total *Line) *table {
+			return &table{Heading: heading, Lines: lines, Total: total}
+		},
+	}
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(formatter{}.funcs()).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Chargeback by {{.Report.TagKey}}: {{.Report.Month.Format "January 2006"}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+td.n { text-align: right; }
+tr.total { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Chargeback by {{.Report.TagKey}}: {{.Report.Month.Format "January 2006"}}</h1>
+<p>Costs in {{.Report.Currency}}, compared to {{.Report.PreviousMonth.Format "January 2006"}}.</p>
+{{template "table" (table .Report.TagKey .Summary .Report.Total)}}
+{{range .Report.Sections}}
+<h2>{{.TagValue}}</h2>
+{{template "table" (table "Meter Category" .Categories .Total)}}
+{{template "table" (table "Resource Group" .Groups .Total)}}
+{{end}}
+</body>
+</html>
+{{define "table"}}<table>
+<tr><th>{{.Heading}}</th><th>Cost</th><th>Previous</th><th>Change</th><th>Change %</th></tr>
+{{range .Lines}}<tr><td>{{.Name}}</td><td class="n">{{cost .}}</td><td class="n">{{previous .}}</td><td class="n">{{change .}}</td><td class="n">{{percent .}}</td></tr>
+{{end}}{{with .Total}}<tr class="total"><td>{{.Name}}</td><td class="n">{{cost .}}</td><td class="n">{{previous .}}</td><td class="n">{{change .}}</td><td class="n">{{percent .}}</td></tr>
+{{end}}</table>{{end}}`))
+
+type table struct {
+	Heading string
+	Lines   []*Line
+	Total   *Line
+}
+
+// WriteHTML - Renders the report as a standalone HTML page, costs are rounded by rounder
+func WriteHTML(w io.Writer, r *Report, rounder money.Rounder) (err error) {
+	t, err := htmlTemplate.Clone()
+	if err != nil {
+		return err
+	}
+
+	return t.Funcs(formatter{rounder: rounder}.funcs()).Execute(w, struct {
+		Report  *Report
+		Summary []*Line
+	}{r, r.summary()})
+}
@@ -0,0 +1,75 @@
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/output"
+)
+
+// State - Local state kept between runs
+type State struct {
+	path      string
+	Alerts    map[string]time.Time           `json:"alerts"`
+	Baselines map[string][]*domain.DailyCost `json:"baselines"`
+}
+
+// Path - Location of the state file of a subscription, StateDir falls back to the output directory
+func Path(config *domain.Config) string {
+	dir := config.StateDir
+	if len(dir) == 0 {
+		dir = output.Dir(config.OutputDir)
+	}
+
+	return filepath.Join(dir, "_"+config.Subscription+"_state.json")
+}
+
+// Load - Reads the state file, a missing file gives an empty state
+func Load(path string) (s *State, err error) {
+	s = &State{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Alerts == nil {
+		s.Alerts = make(map[string]time.Time)
+	}
+
+	if s.Baselines == nil {
+		s.Baselines = make(map[string][]*domain.DailyCost)
+	}
+
+	return s, nil
+}
+
+// Save - Atomically replaces the state file
+func (s *State) Save() (err error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := output.Create(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	return file.Commit()
+}
@@ -0,0 +1,182 @@
+package tags
+
+import (
+	"bufio"
+	gocsv "encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+	"bitbucket.org/corneilebritz/cloudcostcalculator/money"
+
+	"github.com/shopspring/decimal"
+)
+
+// NoResourceGroup - Resource group reported for records that do not belong to one
+const NoResourceGroup = "(none)"
+
+// AuditLine - Compliance of a resource group with a required tag. GroupMissing is set when the
+// resource group itself lacks the tag, Resources lists the resources that lack it and FallbackCost
+// is the cost whose tag value is absent or came from the default rather than a resource, group,
+// subscription or rule
+type AuditLine struct {
+	Subscription  string
+	ResourceGroup string
+	Tag           string
+	GroupMissing  bool
+	Resources     []string
+	FallbackCost  decimal.Decimal
+	TotalCost     decimal.Decimal
+}
+
+// Audit - Checks every TagDefaults key against the resource groups and the priced records after
+// ApplyDefaults and the tag rules have run. Resource groups are matched regardless of case and records
+// without one are reported under NoResourceGroup. Lines are only returned for resource groups with a gap
+func Audit(records []*domain.UsageRecord, groupMap map[string]*domain.Group, config *domain.Config) (lines []*AuditLine) {
+	names := make(map[string]string)
+	for name := range groupMap {
+		if current, found := names[fold(name)]; !found || name < current {
+			names[fold(name)] = name
+		}
+	}
+
+	data := make(map[string]*AuditLine)
+	resources := make(map[string]map[string]bool)
+	line := func(group, tag string) *AuditLine {
+		if len(strings.TrimSpace(group)) == 0 {
+			group = NoResourceGroup
+		} else if name, found := names[fold(group)]; found {
+			group = name
+		}
+
+		key := fmt.Sprintf("%s/%s", fold(group), tag)
+		l, found := data[key]
+		if !found {
+			l = &AuditLine{Subscription: config.Subscription, ResourceGroup: group, Tag: tag}
+			if g, ok := groupMap[group]; group != NoResourceGroup && (!ok || len(String(g.Tags[tag])) == 0) {
+				l.GroupMissing = true
+			}
+			data[key] = l
+			resources[key] = make(map[string]bool)
+		}
+
+		return l
+	}
+
+	for name := range groupMap {
+		for tag := range config.TagDefaults {
+			line(name, tag)
+		}
+	}
+
+	for _, record := range records {
+		for tag := range config.TagDefaults {
+			l := line(record.Properties.ResourceGroup, tag)
+			l.TotalCost = l.TotalCost.Add(record.Properties.Cost)
+
+			var value string
+			if record.Properties.InstanceData != nil {
+				value = String(record.Properties.InstanceData.Resources.Tags[tag])
+			}
+
+			source := record.Properties.TagSources[tag]
+			if len(value) == 0 || len(source) == 0 || source == SourceDefault || source == SourceMissing {
+				l.FallbackCost = l.FallbackCost.Add(record.Properties.Cost)
+			}
+
+			if source != SourceResource && len(record.Properties.Resource) > 0 {
+				resources[fmt.Sprintf("%s/%s", fold(l.ResourceGroup), tag)][record.Properties.Resource] = true
+			}
+		}
+	}
+
+	for key, l := range data {
+		for resource := range resources[key] {
+			l.Resources = append(l.Resources, resource)
+		}
+		sort.Strings(l.Resources)
+
+		if l.GroupMissing || len(l.Resources) > 0 || !l.FallbackCost.IsZero() {
+			lines = append(lines, l)
+		}
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].ResourceGroup != lines[j].ResourceGroup {
+			return lines[i].ResourceGroup < lines[j].ResourceGroup
+		}
+
+		return lines[i].Tag < lines[j].Tag
+	})
+
+	return lines
+}
+
+// WriteAuditCSV - Writes a line per resource group and tag, the resources lacking the tag are
+// separated by semicolons
+func WriteAuditCSV(w io.Writer, lines []*AuditLine, rounder money.Rounder) (err error) {
+	bw := bufio.NewWriter(w)
+	cw := gocsv.NewWriter(bw)
+
+	if err := cw.Write([]string{"Subscription", "ResourceGroup", "Tag", "GroupMissing", "MissingResources", "Resources", "FallbackCost", "TotalCost"}); err != nil {
+		return err
+	}
+
+	for _, l := range lines {
+		parts := []string{
+			l.Subscription,
+			l.ResourceGroup,
+			l.Tag,
+			strconv.FormatBool(l.GroupMissing),
+			strconv.Itoa(len(l.Resources)),
+			strings.Join(l.Resources, ";"),
+			rounder.Format(l.FallbackCost),
+			rounder.Format(l.TotalCost),
+		}
+
+		if err := cw.Write(parts); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// WriteAuditJSON - Writes the lines as a JSON array with the costs rounded by rounder
+func WriteAuditJSON(w io.Writer, lines []*AuditLine, rounder money.Rounder) (err error) {
+	type jsonLine struct {
+		Subscription  string   `json:"subscription"`
+		ResourceGroup string   `json:"resourceGroup"`
+		Tag           string   `json:"tag"`
+		GroupMissing  bool     `json:"groupMissing"`
+		Resources     []string `json:"resources"`
+		FallbackCost  float64  `json:"fallbackCost"`
+		TotalCost     float64  `json:"totalCost"`
+	}
+
+	out := make([]*jsonLine, 0, len(lines))
+	for _, l := range lines {
+		out = append(out, &jsonLine{
+			Subscription:  l.Subscription,
+			ResourceGroup: l.ResourceGroup,
+			Tag:           l.Tag,
+			GroupMissing:  l.GroupMissing,
+			Resources:     append([]string{}, l.Resources...),
+			FallbackCost:  rounder.Float(l.FallbackCost),
+			TotalCost:     rounder.Float(l.TotalCost),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
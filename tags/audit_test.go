@@ -0,0 +1,90 @@
+package tags
+
+import (
+	"testing"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+
+	"github.com/shopspring/decimal"
+)
+
+func auditRecord(group, resource string, cost int64, resourceTags map[string]interface{}) *domain.UsageRecord {
+	record := &domain.UsageRecord{}
+	record.Properties.ResourceGroup = group
+	record.Properties.Resource = resource
+	record.Properties.MeterCategory = "Storage"
+	record.Properties.Cost = decimal.NewFromInt(cost)
+	if resourceTags != nil {
+		record.Properties.InstanceData = &domain.InstanceData{}
+		record.Properties.InstanceData.Resources.Tags = resourceTags
+	}
+
+	return record
+}
+
+func auditLine(lines []*AuditLine, group, tag string) *AuditLine {
+	for _, l := range lines {
+		if l.ResourceGroup == group && l.Tag == tag {
+			return l
+		}
+	}
+
+	return nil
+}
+
+func TestAuditCountsRuleCreatedInstanceDataAsFallback(t *testing.T) {
+	config := &domain.Config{
+		TagDefaults: map[string]string{"Owner": "unknown", "Service": "unknown"},
+		TagRules:    []*domain.TagRule{{Tag: "Service", Field: "MeterCategory", Pattern: "^(.+)$", Value: "$1"}},
+	}
+	groupMap := map[string]*domain.Group{"web": {Tags: map[string]interface{}{"Owner": "bob", "Service": "web"}}}
+
+	records := []*domain.UsageRecord{auditRecord("web", "disk", 10, nil)}
+	ApplyDefaults(records, groupMap, nil, config)
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.Apply(records)
+
+	if records[0].Properties.InstanceData == nil {
+		t.Fatal("expected the rule to create instance data")
+	}
+
+	lines := Audit(records, groupMap, config)
+
+	owner := auditLine(lines, "web", "Owner")
+	if owner == nil || !owner.FallbackCost.Equal(decimal.NewFromInt(10)) || !owner.TotalCost.Equal(decimal.NewFromInt(10)) {
+		t.Fatalf("expected the Owner fallback to be the full cost of 10, got %+v", owner)
+	}
+
+	if service := auditLine(lines, "web", "Service"); service == nil || !service.FallbackCost.IsZero() {
+		t.Errorf("expected no fallback cost for the rule derived Service tag, got %+v", service)
+	}
+}
+
+func TestAuditFoldsGroupsAndReportsRecordsWithoutOne(t *testing.T) {
+	config := &domain.Config{TagDefaults: map[string]string{"Owner": "unknown"}}
+	groupMap := map[string]*domain.Group{"Web-RG": {Tags: map[string]interface{}{"Owner": "bob"}}}
+
+	records := []*domain.UsageRecord{
+		auditRecord("web-rg", "vm", 4, map[string]interface{}{}),
+		auditRecord("WEB-RG", "vm", 6, map[string]interface{}{}),
+		auditRecord("", "", 1, map[string]interface{}{}),
+	}
+	ApplyDefaults(records, groupMap, nil, config)
+
+	lines := Audit(records, groupMap, config)
+	if len(lines) != 2 {
+		t.Fatalf("expected a line for Web-RG and one without a group, got %d", len(lines))
+	}
+
+	if l := auditLine(lines, NoResourceGroup, "Owner"); l == nil || l.GroupMissing {
+		t.Errorf("expected records without a group under %s without a missing group, got %+v", NoResourceGroup, l)
+	}
+
+	if l := auditLine(lines, "Web-RG", "Owner"); l == nil || l.GroupMissing || !l.TotalCost.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("expected both spellings under Web-RG with a total of 10, got %+v", l)
+	}
+}
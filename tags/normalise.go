@@ -0,0 +1,209 @@
+package tags
+
+import (
+	"sort"
+	"strings"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+// AnyKey - ValueAliases key whose aliases apply to every tag
+const AnyKey = "*"
+
+// Normaliser - Rewrites tag keys and values to their canonical form so that keys and values differing
+// only in case, surrounding spaces or a configured alias are treated as the same tag. Keys and values
+// without a canonical form are only trimmed unless foldUnknown is set, then the first spelling seen
+// becomes their canonical form
+type Normaliser struct {
+	keys        map[string]string
+	values      map[string]map[string]string
+	foldUnknown bool
+}
+
+// NewNormaliser - Canonical keys are the TagDefaults keys, the tag dimensions, the tag rule and allowed
+// passthrough tags and the key alias targets. Canonical values are the value alias targets and the
+// TagDefaults values
+func NewNormaliser(config *domain.Config) *Normaliser {
+	n := &Normaliser{
+		keys:   make(map[string]string),
+		values: make(map[string]map[string]string),
+	}
+
+	for key, value := range config.TagDefaults {
+		n.addKey(key, key)
+		n.addValue(key, value, value)
+	}
+
+	for _, dimension := range config.Dimensions {
+		if strings.HasPrefix(dimension, "_") {
+			key := strings.TrimPrefix(dimension, "_")
+			n.addKey(key, key)
+		}
+	}
+
+	for _, r := range config.TagRules {
+		n.addKey(r.Tag, r.Tag)
+		if strings.HasPrefix(r.Field, "_") {
+			key := strings.TrimPrefix(r.Field, "_")
+			n.addKey(key, key)
+		}
+	}
+
+	if config.TagPassthrough != nil {
+		for _, key := range config.TagPassthrough.Allow {
+			n.addKey(key, key)
+		}
+	}
+
+	if config.TagNormalisation == nil {
+		return n
+	}
+	n.foldUnknown = config.TagNormalisation.FoldUnknown
+
+	for _, key := range config.TagNormalisation.KeyAliases {
+		n.addKey(key, key)
+	}
+
+	for alias, key := range config.TagNormalisation.KeyAliases {
+		n.addKey(alias, n.Key(key))
+	}
+
+	for key, aliases := range config.TagNormalisation.ValueAliases {
+		if key != AnyKey {
+			key = n.Key(key)
+		}
+
+		for alias, value := range aliases {
+			n.addValue(key, value, value)
+			n.addValue(key, alias, value)
+		}
+	}
+
+	return n
+}
+
+// addKey - A key that is canonical itself is never replaced by an alias
+func (n *Normaliser) addKey(key, canonical string) {
+	folded := fold(key)
+	if current, found := n.keys[folded]; found && (fold(current) == folded || fold(canonical) != folded) {
+		return
+	}
+
+	n.keys[folded] = strings.TrimSpace(canonical)
+}
+
+func (n *Normaliser) addValue(key, value, canonical string) {
+	if n.values[key] == nil {
+		n.values[key] = make(map[string]string)
+	}
+
+	n.values[key][fold(value)] = strings.TrimSpace(canonical)
+}
+
+// Key - Canonical form of a tag key, unknown keys are trimmed or folded onto their first spelling
+func (n *Normaliser) Key(key string) string {
+	if canonical, found := n.keys[fold(key)]; found {
+		return canonical
+	}
+
+	if n.foldUnknown {
+		n.addKey(key, key)
+	}
+
+	return strings.TrimSpace(key)
+}
+
+// Value - Canonical form of the value of a canonical key, unknown values are trimmed or folded onto
+// their first spelling
+func (n *Normaliser) Value(key, value string) string {
+	if canonical, found := n.values[key][fold(value)]; found {
+		return canonical
+	}
+
+	if canonical, found := n.values[AnyKey][fold(value)]; found {
+		return canonical
+	}
+
+	if n.foldUnknown {
+		n.addValue(key, value, value)
+	}
+
+	return strings.TrimSpace(value)
+}
+
+// Tags - Returns the tags with canonical keys and values. When several keys fold to the same key the
+// first non-empty value wins, trying the key already in canonical form first and then the others in
+// sorted order, which is also the order unknown spellings are first seen in
+func (n *Normaliser) Tags(tags map[string]interface{}) map[string]interface{} {
+	if tags == nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ci, cj := n.canonical(keys[i]), n.canonical(keys[j])
+		if ci != cj {
+			return ci
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	normalised := make(map[string]interface{})
+	for _, key := range keys {
+		canonical := n.Key(key)
+
+		value := tags[key]
+		if v, ok := value.(string); ok {
+			value = n.Value(canonical, v)
+		}
+
+		if current, found := normalised[canonical]; found && !empty(current) {
+			continue
+		}
+
+		normalised[canonical] = value
+	}
+
+	return normalised
+}
+
+// canonical - Whether the key is the canonical spelling of a known key
+func (n *Normaliser) canonical(key string) bool {
+	current, found := n.keys[fold(key)]
+	return found && current == key
+}
+
+// Normalise - Rewrites the tags of the records to their canonical form
+func Normalise(records []*domain.UsageRecord, n *Normaliser) {
+	for _, record := range records {
+		if record.Properties.InstanceData != nil {
+			record.Properties.InstanceData.Resources.Tags = n.Tags(record.Properties.InstanceData.Resources.Tags)
+		}
+	}
+}
+
+// NormaliseGroups - Rewrites the tags of the resource groups to their canonical form, in name order
+// so the spellings seen first do not depend on map order
+func NormaliseGroups(groupMap map[string]*domain.Group, n *Normaliser) {
+	names := make([]string, 0, len(groupMap))
+	for name := range groupMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		groupMap[name].Tags = n.Tags(groupMap[name].Tags)
+	}
+}
+
+func empty(value interface{}) bool {
+	return len(String(value)) == 0
+}
+
+func fold(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
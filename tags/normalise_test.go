@@ -0,0 +1,71 @@
+package tags
+
+import (
+	"reflect"
+	"testing"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+func TestNormaliserFoldsConfiguredKeysAndValues(t *testing.T) {
+	n := NewNormaliser(&domain.Config{
+		TagDefaults: map[string]string{"Environment": "Production", "CostCentre": "none"},
+		TagNormalisation: &domain.TagNormalisation{
+			KeyAliases:   map[string]string{"env": "Environment"},
+			ValueAliases: map[string]map[string]string{"Environment": {"prod": "Production"}},
+		},
+	})
+
+	tags := n.Tags(map[string]interface{}{
+		" COSTCENTRE": "CC-ABC",
+		"env":         "prod",
+		"Owner":       "Jane Doe",
+	})
+
+	expected := map[string]interface{}{
+		"CostCentre":  "CC-ABC",
+		"Environment": "Production",
+		"Owner":       "Jane Doe",
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+
+	if value := n.Value("Environment", " PRODUCTION "); value != "Production" {
+		t.Errorf("expected the TagDefaults value, got %q", value)
+	}
+}
+
+func TestNormaliserKeepsUnknownSpellingsByDefault(t *testing.T) {
+	n := NewNormaliser(&domain.Config{TagNormalisation: &domain.TagNormalisation{}})
+
+	if key := n.Key(" Owner "); key != "Owner" {
+		t.Errorf("expected the unknown key to be trimmed only, got %q", key)
+	}
+
+	if key := n.Key("OWNER"); key != "OWNER" {
+		t.Errorf("expected a second spelling to be kept, got %q", key)
+	}
+
+	if value := n.Value("Owner", "Jane Doe"); value != "Jane Doe" {
+		t.Errorf("expected the unknown value to be kept, got %q", value)
+	}
+}
+
+func TestNormaliserFoldUnknownKeepsTheFirstSpelling(t *testing.T) {
+	n := NewNormaliser(&domain.Config{TagNormalisation: &domain.TagNormalisation{FoldUnknown: true}})
+
+	groupMap := map[string]*domain.Group{
+		"b": {Tags: map[string]interface{}{"owner": "jane doe"}},
+		"a": {Tags: map[string]interface{}{"Owner": "", "OWNER": "Jane Doe"}},
+	}
+	NormaliseGroups(groupMap, n)
+
+	if tags := groupMap["a"].Tags; !reflect.DeepEqual(tags, map[string]interface{}{"OWNER": "Jane Doe"}) {
+		t.Errorf("expected the first sorted spelling with the non-empty value, got %v", tags)
+	}
+
+	if tags := groupMap["b"].Tags; !reflect.DeepEqual(tags, map[string]interface{}{"OWNER": "Jane Doe"}) {
+		t.Errorf("expected the later group to take the first spelling, got %v", tags)
+	}
+}
@@ -0,0 +1,197 @@
+package tags
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+// ruleFields - Record fields a rule can match on, tags are referenced with an underscore prefix
+var ruleFields = map[string]func(record *domain.UsageRecord, config *domain.Config) string{
+	"SubscriptionID": func(record *domain.UsageRecord, config *domain.Config) string {
+		return record.Properties.SubscriptionID
+	},
+	"Subscription":  func(record *domain.UsageRecord, config *domain.Config) string { return config.Subscription },
+	"MeterID":       func(record *domain.UsageRecord, config *domain.Config) string { return record.Properties.MeterID },
+	"MeterName":     func(record *domain.UsageRecord, config *domain.Config) string { return record.Properties.MeterName },
+	"MeterCategory": func(record *domain.UsageRecord, config *domain.Config) string { return record.Properties.MeterCategory },
+	"MeterSubCategory": func(record *domain.UsageRecord, config *domain.Config) string {
+		return record.Properties.MeterSubCategory
+	},
+	"MeterRegion":   func(record *domain.UsageRecord, config *domain.Config) string { return record.Properties.MeterRegion },
+	"ResourceGroup": func(record *domain.UsageRecord, config *domain.Config) string { return record.Properties.ResourceGroup },
+	"Resource":      func(record *domain.UsageRecord, config *domain.Config) string { return record.Properties.Resource },
+	"ResourceID": func(record *domain.UsageRecord, config *domain.Config) string {
+		if record.Properties.InstanceData == nil {
+			return ""
+		}
+
+		return record.Properties.InstanceData.Resources.ResourceURI
+	},
+	"Location": func(record *domain.UsageRecord, config *domain.Config) string {
+		if record.Properties.InstanceData == nil {
+			return ""
+		}
+
+		return record.Properties.InstanceData.Resources.Location
+	},
+}
+
+// Derivation - A tag value set by a rule on a record
+type Derivation struct {
+	Record   *domain.UsageRecord
+	Tag      string
+	Value    string
+	Previous string
+	Rule     string
+}
+
+type rule struct {
+	*domain.TagRule
+	pattern *regexp.Regexp
+}
+
+// Engine - Applies the tag rules in order
+type Engine struct {
+	config *domain.Config
+	rules  []*rule
+}
+
+// NewEngine - Compiles the rules of the configuration, rejecting unknown fields, invalid patterns and
+// tags that never reach a point. Tags and tag fields are rewritten to their canonical keys
+func NewEngine(config *domain.Config) (e *Engine, err error) {
+	e = &Engine{config: config}
+	n := NewNormaliser(config)
+
+	for i, r := range config.TagRules {
+		name := r.Name
+		if len(name) == 0 {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		if len(r.Tag) == 0 {
+			return nil, fmt.Errorf("tag rule %s: tag is required", name)
+		}
+
+		if !reachable(config, r.Tag) {
+			return nil, fmt.Errorf("tag rule %s: tag %s is not in TagDefaults, the dimensions or the passthrough tags", name, r.Tag)
+		}
+
+		if _, ok := ruleFields[r.Field]; !ok && !strings.HasPrefix(r.Field, "_") {
+			return nil, fmt.Errorf("tag rule %s: unknown field %s", name, r.Field)
+		}
+
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("tag rule %s: %v", name, err)
+		}
+
+		copied := *r
+		copied.Name = name
+		copied.Tag = n.Key(r.Tag)
+		if strings.HasPrefix(r.Field, "_") {
+			copied.Field = fmt.Sprintf("_%s", n.Key(strings.TrimPrefix(r.Field, "_")))
+		}
+		e.rules = append(e.rules, &rule{TagRule: &copied, pattern: pattern})
+	}
+
+	return e, nil
+}
+
+// Apply - Runs the rules over the records in order and returns every tag value they set. Records
+// without instance data are given one to carry the tags the rules set
+func (e *Engine) Apply(records []*domain.UsageRecord) (derivations []*Derivation) {
+	if len(e.rules) == 0 {
+		return nil
+	}
+
+	for _, record := range records {
+		if record.Properties.TagSources == nil {
+			record.Properties.TagSources = make(map[string]string)
+		}
+
+		for _, r := range e.rules {
+			value := e.field(record, r.Field)
+			match := r.pattern.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+
+			if record.Properties.InstanceData == nil {
+				record.Properties.InstanceData = &domain.InstanceData{}
+			}
+
+			tags := record.Properties.InstanceData.Resources.Tags
+			if tags == nil {
+				tags = make(map[string]interface{})
+				record.Properties.InstanceData.Resources.Tags = tags
+			}
+
+			current := String(tags[r.Tag])
+			if !r.Overwrite && len(current) > 0 && record.Properties.TagSources[r.Tag] != SourceDefault {
+				continue
+			}
+
+			result := string(r.pattern.ExpandString(nil, r.Value, value, match))
+			tags[r.Tag] = result
+			record.Properties.TagSources[r.Tag] = SourceRule
+
+			derivations = append(derivations, &Derivation{
+				Record:   record,
+				Tag:      r.Tag,
+				Value:    result,
+				Previous: current,
+				Rule:     r.Name,
+			})
+		}
+	}
+
+	return derivations
+}
+
+// Rules - Names of the rules in order
+func (e *Engine) Rules() (names []string) {
+	for _, r := range e.rules {
+		names = append(names, r.Name)
+	}
+
+	return names
+}
+
+// reachable - Whether a tag set on a record ends up on a point, as a tag dimension or a passthrough tag
+func reachable(config *domain.Config, tag string) bool {
+	if len(config.Dimensions) > 0 {
+		for _, dimension := range config.Dimensions {
+			if fold(dimension) == fold(fmt.Sprintf("_%s", tag)) {
+				return true
+			}
+		}
+	} else {
+		for key := range config.TagDefaults {
+			if fold(key) == fold(tag) {
+				return true
+			}
+		}
+	}
+
+	if config.TagPassthrough == nil {
+		return false
+	}
+
+	allow, listed := passthroughAllowed(config.TagPassthrough)[fold(tag)]
+	return allow || (!listed && config.TagPassthrough.All)
+}
+
+func (e *Engine) field(record *domain.UsageRecord, field string) string {
+	if value, ok := ruleFields[field]; ok {
+		return value(record, e.config)
+	}
+
+	if record.Properties.InstanceData == nil {
+		return ""
+	}
+
+	return String(record.Properties.InstanceData.Resources.Tags[strings.TrimPrefix(field, "_")])
+}
@@ -0,0 +1,107 @@
+package tags
+
+import (
+	"testing"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+func ruleRecord(category string, resourceTags map[string]interface{}) *domain.UsageRecord {
+	record := &domain.UsageRecord{}
+	record.Properties.MeterCategory = category
+	if resourceTags != nil {
+		record.Properties.InstanceData = &domain.InstanceData{}
+		record.Properties.InstanceData.Resources.Tags = resourceTags
+	}
+
+	return record
+}
+
+func TestEngineAppliesRulesInOrder(t *testing.T) {
+	config := &domain.Config{
+		TagDefaults: map[string]string{"Service": "unknown", "Environment": "unknown"},
+		TagRules: []*domain.TagRule{
+			{Name: "category", Tag: "service", Field: "MeterCategory", Pattern: "^Virtual (.+)$", Value: "vm-$1"},
+			{Name: "keep", Tag: "Environment", Field: "_service", Pattern: "^vm-", Value: "compute"},
+			{Name: "overwrite", Tag: "Service", Field: "MeterCategory", Pattern: "Machines", Value: "compute", Overwrite: true},
+		},
+	}
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagged := ruleRecord("Virtual Machines", map[string]interface{}{"Environment": "prod"})
+	tagged.Properties.TagSources = map[string]string{"Environment": SourceResource}
+
+	derivations := engine.Apply([]*domain.UsageRecord{tagged})
+	if len(derivations) != 2 {
+		t.Fatalf("expected the category and overwrite rules to set tags, got %d derivations", len(derivations))
+	}
+
+	resourceTags := tagged.Properties.InstanceData.Resources.Tags
+	if resourceTags["Service"] != "compute" || derivations[1].Previous != "vm-Machines" {
+		t.Errorf("expected the overwrite rule to replace vm-Machines, got %v", resourceTags["Service"])
+	}
+
+	if resourceTags["Environment"] != "prod" {
+		t.Errorf("expected the resource Environment to be kept, got %v", resourceTags["Environment"])
+	}
+}
+
+func TestEngineAppliesRulesWithoutInstanceData(t *testing.T) {
+	config := &domain.Config{
+		TagDefaults: map[string]string{"Service": "unknown"},
+		TagRules:    []*domain.TagRule{{Tag: "Service", Field: "MeterCategory", Pattern: "^(.+)$", Value: "$1"}},
+	}
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matched, unmatched := ruleRecord("Storage", nil), ruleRecord("", nil)
+	engine.Apply([]*domain.UsageRecord{matched, unmatched})
+
+	if matched.Properties.InstanceData == nil || matched.Properties.InstanceData.Resources.Tags["Service"] != "Storage" {
+		t.Errorf("expected the rule to tag a record without instance data, got %+v", matched.Properties.InstanceData)
+	}
+
+	if matched.Properties.TagSources["Service"] != SourceRule {
+		t.Errorf("expected the rule source, got %q", matched.Properties.TagSources["Service"])
+	}
+
+	if unmatched.Properties.InstanceData != nil {
+		t.Error("expected no instance data for a record no rule matched")
+	}
+}
+
+func TestNewEngineRejectsUnreachableTags(t *testing.T) {
+	rules := []*domain.TagRule{{Name: "team", Tag: "Team", Field: "MeterCategory", Pattern: ".*"}}
+
+	if _, err := NewEngine(&domain.Config{TagRules: rules}); err == nil {
+		t.Error("expected a tag that is neither a default, a dimension nor passed through to be rejected")
+	}
+
+	reachable := []*domain.Config{
+		{TagRules: rules, TagDefaults: map[string]string{"team": "none"}},
+		{TagRules: rules, Dimensions: []string{"MeterID", "_Team"}},
+		{TagRules: rules, TagPassthrough: &domain.TagPassthrough{Allow: []string{"team"}}},
+		{TagRules: rules, TagPassthrough: &domain.TagPassthrough{All: true}},
+	}
+	for i, config := range reachable {
+		if _, err := NewEngine(config); err != nil {
+			t.Errorf("config %d: %v", i, err)
+		}
+	}
+
+	denied := &domain.Config{TagRules: rules, TagPassthrough: &domain.TagPassthrough{All: true, Deny: []string{"TEAM"}}}
+	if _, err := NewEngine(denied); err == nil {
+		t.Error("expected a denied passthrough tag to be rejected")
+	}
+
+	if _, err := NewEngine(&domain.Config{TagRules: []*domain.TagRule{{Tag: "Team", Field: "Unknown"}}, TagDefaults: map[string]string{"Team": ""}}); err == nil {
+		t.Error("expected an unknown field to be rejected")
+	}
+}
@@ -1,40 +1,220 @@
 package tags
 
 import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
 	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
 )
 
-// ApplyDefaults - Apply default values to the record
-func ApplyDefaults(records []*domain.UsageRecord, groupMap map[string]*domain.Group, tagDefaults map[string]string) (err error) {
+// Tiers a tag value can come from, recorded per tag on records and points
+const (
+	SourceResource     = "resource"
+	SourceGroup        = "group"
+	SourceSubscription = "subscription"
+	SourceDefault      = "default"
+	SourceMissing      = "missing"
+	SourceRule         = "rule"
+	SourceAllocation   = "allocation"
+	SourceMixed        = "mixed"
+)
+
+// DefaultPrecedence - Order the tiers are consulted in when TagPrecedence is not configured, the
+// static TagDefaults value always comes last
+var DefaultPrecedence = []string{SourceResource, SourceGroup, SourceSubscription}
+
+// Precedence - Returns the configured tier order, falling back to the default
+func Precedence(config *domain.Config) []string {
+	if len(config.TagPrecedence) == 0 {
+		return DefaultPrecedence
+	}
+
+	return config.TagPrecedence
+}
+
+// ValidatePrecedence - Ensures the tier order only names the resource, group and subscription tiers,
+// each at most once
+func ValidatePrecedence(precedence []string) (err error) {
+	seen := make(map[string]bool)
+	for _, tier := range precedence {
+		switch tier {
+		case SourceResource, SourceGroup, SourceSubscription:
+		default:
+			return fmt.Errorf("unknown tag precedence tier: %s", tier)
+		}
+
+		if seen[tier] {
+			return fmt.Errorf("duplicate tag precedence tier: %s", tier)
+		}
+		seen[tier] = true
+	}
+
+	return nil
+}
+
+// ApplyDefaults - Sets every TagDefaults key of the records to the first non-empty value of the
+// resource, resource group or subscription tiers in precedence order, falling back to the default.
+// The tier that supplied each tag is recorded in TagSources
+func ApplyDefaults(records []*domain.UsageRecord, groupMap map[string]*domain.Group, subscriptionTags map[string]interface{}, config *domain.Config) (err error) {
+	precedence := Precedence(config)
+
 	for _, record := range records {
 		if record.Properties.InstanceData == nil {
 			continue
 		}
 
-		for key, value := range tagDefaults {
-			current, ok := record.Properties.InstanceData.Resources.Tags[key]
-			if !ok {
-				current = ""
-			}
+		resourceTags := record.Properties.InstanceData.Resources.Tags
+		if resourceTags == nil {
+			resourceTags = make(map[string]interface{})
+			record.Properties.InstanceData.Resources.Tags = resourceTags
+		}
 
-			switch v := current.(type) {
-			case string:
-				if len(v) > 0 {
-					continue
-				}
-			}
+		var groupTags map[string]interface{}
+		if group, groupOK := groupMap[record.Properties.ResourceGroup]; groupOK {
+			groupTags = group.Tags
+		}
+
+		tiers := map[string]map[string]interface{}{
+			SourceResource:     resourceTags,
+			SourceGroup:        groupTags,
+			SourceSubscription: subscriptionTags,
+		}
 
-			if group, groupOK := groupMap[record.Properties.ResourceGroup]; groupOK {
-				if groupTag, groupTagOK := group.Tags[key]; groupTagOK {
-					record.Properties.InstanceData.Resources.Tags[key] = groupTag
-					continue
+		if record.Properties.TagSources == nil {
+			record.Properties.TagSources = make(map[string]string)
+		}
+
+		for key, value := range config.TagDefaults {
+			var tagValue interface{} = value
+			source := SourceDefault
+
+			for _, tier := range precedence {
+				if v := tiers[tier][key]; len(String(v)) > 0 {
+					tagValue, source = v, tier
+					break
 				}
 			}
 
-			record.Properties.InstanceData.Resources.Tags[key] = value
-
+			resourceTags[key] = tagValue
+			record.Properties.TagSources[key] = source
 		}
 	}
 
 	return nil
 }
+
+// SourceField - Name of the output field holding the tier that supplied a tag dimension
+func SourceField(dimension string) string {
+	return fmt.Sprintf("TagSource%s", dimension)
+}
+
+// IsSourceField - Reports whether a field or column name holds the tier of a tag dimension
+func IsSourceField(field string) bool {
+	return strings.HasPrefix(field, "TagSource_")
+}
+
+// SourceDimension - Tag dimension of a source field
+func SourceDimension(field string) string {
+	return strings.TrimPrefix(field, "TagSource")
+}
+
+// MergeSources - Adds the tag sources of a point summed into target, tags supplied by different
+// tiers are marked mixed
+func MergeSources(target, sources map[string]string) {
+	for dimension, source := range sources {
+		if current, found := target[dimension]; found && current != source {
+			target[dimension] = SourceMixed
+			continue
+		}
+
+		target[dimension] = source
+	}
+}
+
+// CopySources - Returns a copy of the tag sources of a point
+func CopySources(sources map[string]string) (copied map[string]string) {
+	copied = make(map[string]string)
+	for dimension, source := range sources {
+		copied[dimension] = source
+	}
+
+	return copied
+}
+
+// String - Converts a tag value to a string. Numbers and booleans are formatted as they appear in
+// JSON, objects and arrays are encoded as JSON and a missing value is empty
+func String(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	}
+
+	if b, err := json.Marshal(value); err == nil {
+		return string(b)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// Passthrough - Returns the resource tags of the record selected by the passthrough configuration,
+// keyed as tag dimensions. Allow and Deny match keys regardless of case and surrounding spaces.
+// Empty values are left out
+func Passthrough(record *domain.UsageRecord, passthrough *domain.TagPassthrough) (tags map[string]string) {
+	tags = make(map[string]string)
+	if passthrough == nil || record.Properties.InstanceData == nil {
+		return tags
+	}
+
+	allowed := passthroughAllowed(passthrough)
+
+	for key, value := range record.Properties.InstanceData.Resources.Tags {
+		if allow, listed := allowed[fold(key)]; !allow && (listed || !passthrough.All) {
+			continue
+		}
+
+		if v := String(value); len(v) > 0 {
+			tags[fmt.Sprintf("_%s", key)] = v
+		}
+	}
+
+	return tags
+}
+
+// PassthroughDimensions - Tag dimensions of the Allow list that are not denied, in canonical form. Tags
+// only copied by All are not known in advance and have no dimension here
+func PassthroughDimensions(passthrough *domain.TagPassthrough, n *Normaliser) (dimensions []string) {
+	if passthrough == nil {
+		return nil
+	}
+
+	allowed := passthroughAllowed(passthrough)
+	for _, key := range passthrough.Allow {
+		if allowed[fold(key)] {
+			dimensions = append(dimensions, fmt.Sprintf("_%s", n.Key(key)))
+		}
+	}
+
+	return dimensions
+}
+
+func passthroughAllowed(passthrough *domain.TagPassthrough) (allowed map[string]bool) {
+	allowed = make(map[string]bool)
+	for _, key := range passthrough.Allow {
+		allowed[fold(key)] = true
+	}
+	for _, key := range passthrough.Deny {
+		allowed[fold(key)] = false
+	}
+
+	return allowed
+}
@@ -0,0 +1,103 @@
+package tags
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"bitbucket.org/corneilebritz/cloudcostcalculator/domain"
+)
+
+func TestStringFormatsNonStringValues(t *testing.T) {
+	var resourceTags map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"count": 3, "ratio": 0.25, "enabled": true, "owners": ["a", "b"], "meta": {"k": "v"}, "none": null}`), &resourceTags); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"count":   "3",
+		"ratio":   "0.25",
+		"enabled": "true",
+		"owners":  `["a","b"]`,
+		"meta":    `{"k":"v"}`,
+		"none":    "",
+	}
+	for key, value := range expected {
+		if s := String(resourceTags[key]); s != value {
+			t.Errorf("%s: expected %q, got %q", key, value, s)
+		}
+	}
+}
+
+func TestPassthroughSelectsTags(t *testing.T) {
+	record := ruleRecord("Storage", map[string]interface{}{"Environment": "prod", "owner": "bob", "Secret": "x", "Empty": ""})
+
+	tests := []struct {
+		passthrough *domain.TagPassthrough
+		expected    map[string]string
+	}{
+		{nil, map[string]string{}},
+		{&domain.TagPassthrough{Allow: []string{"environment", " OWNER"}}, map[string]string{"_Environment": "prod", "_owner": "bob"}},
+		{&domain.TagPassthrough{All: true, Deny: []string{"secret"}}, map[string]string{"_Environment": "prod", "_owner": "bob"}},
+		{&domain.TagPassthrough{Allow: []string{"Secret"}, Deny: []string{"SECRET"}}, map[string]string{}},
+	}
+
+	for i, test := range tests {
+		if tags := Passthrough(record, test.passthrough); !reflect.DeepEqual(tags, test.expected) {
+			t.Errorf("case %d: expected %v, got %v", i, test.expected, tags)
+		}
+	}
+}
+
+func TestPassthroughDimensionsUseCanonicalKeys(t *testing.T) {
+	config := &domain.Config{
+		TagDefaults:    map[string]string{"Environment": "none"},
+		TagPassthrough: &domain.TagPassthrough{Allow: []string{"environment", "Owner", "Secret"}, Deny: []string{"secret"}},
+	}
+
+	dimensions := PassthroughDimensions(config.TagPassthrough, NewNormaliser(config))
+	if expected := []string{"_Environment", "_Owner"}; !reflect.DeepEqual(dimensions, expected) {
+		t.Errorf("expected %v, got %v", expected, dimensions)
+	}
+}
+
+func TestApplyDefaultsInheritsByPrecedence(t *testing.T) {
+	config := &domain.Config{TagDefaults: map[string]string{"Owner": "none", "CostCentre": "none", "Team": "none", "Region": "none"}}
+	groupMap := map[string]*domain.Group{"web": {Tags: map[string]interface{}{"Owner": "group", "CostCentre": "CC-GROUP"}}}
+	subscriptionTags := map[string]interface{}{"Owner": "subscription", "CostCentre": "CC-SUB", "Team": "platform"}
+
+	record := ruleRecord("Storage", map[string]interface{}{"Owner": "resource"})
+	record.Properties.ResourceGroup = "web"
+	ApplyDefaults([]*domain.UsageRecord{record}, groupMap, subscriptionTags, config)
+
+	expected := map[string]string{"Owner": SourceResource, "CostCentre": SourceGroup, "Team": SourceSubscription, "Region": SourceDefault}
+	if !reflect.DeepEqual(record.Properties.TagSources, expected) {
+		t.Errorf("expected sources %v, got %v", expected, record.Properties.TagSources)
+	}
+
+	if value := record.Properties.InstanceData.Resources.Tags["Team"]; value != "platform" {
+		t.Errorf("expected the subscription Team, got %v", value)
+	}
+
+	config.TagPrecedence = []string{SourceSubscription, SourceResource}
+	record = ruleRecord("Storage", map[string]interface{}{"Owner": "resource"})
+	record.Properties.ResourceGroup = "web"
+	ApplyDefaults([]*domain.UsageRecord{record}, groupMap, subscriptionTags, config)
+
+	resourceTags := record.Properties.InstanceData.Resources.Tags
+	if resourceTags["Owner"] != "subscription" || resourceTags["CostCentre"] != "CC-SUB" {
+		t.Errorf("expected the subscription tier first and the group tier skipped, got %v", resourceTags)
+	}
+}
+
+func TestValidatePrecedence(t *testing.T) {
+	if err := ValidatePrecedence([]string{SourceGroup, SourceResource}); err != nil {
+		t.Error(err)
+	}
+
+	for _, precedence := range [][]string{{SourceDefault}, {SourceGroup, SourceGroup}} {
+		if err := ValidatePrecedence(precedence); err == nil {
+			t.Errorf("expected %v to be rejected", precedence)
+		}
+	}
+}